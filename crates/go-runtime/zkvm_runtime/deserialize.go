@@ -2,82 +2,144 @@ package zkvm_runtime
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"reflect"
 )
 
+// DeserializeError is the error returned by TryDeserializeData when data is malformed or does
+// not match the shape of the target.
+type DeserializeError struct {
+	Err error
+}
+
+func (e *DeserializeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeserializeError) Unwrap() error {
+	return e.Err
+}
+
 func DeserializeData(data []byte, e any) {
+	if err := TryDeserializeData(data, e); err != nil {
+		panic(err)
+	}
+}
+
+// TryDeserializeData is DeserializeData returning an error, rather than panicking, when data is
+// malformed or does not match the shape of e.
+func TryDeserializeData(data []byte, e any) error {
 	if e == nil {
-		return
+		return nil
 	}
 	value := reflect.ValueOf(e)
 	// If e represents a value as opposed to a pointer, the answer won't
 	// get back to the caller. Make sure it's a pointer.
 	if value.Type().Kind() != reflect.Pointer {
-		panic("attempt to deserialize into a non-pointer")
+		return errors.New("attempt to deserialize into a non-pointer")
 	}
 
 	if value.IsValid() {
 		if value.Kind() == reflect.Pointer && !value.IsNil() {
 			// That's okay, we'll store through the pointer.
 		} else if !value.CanSet() {
-			panic("gob: DecodeValue of unassignable value")
+			return errors.New("gob: DecodeValue of unassignable value")
 		}
 	}
 
 	index, err := deserializeData(data, value.Elem(), 0)
 	if err != nil {
-		panic(err)
+		return &DeserializeError{Err: err}
 	}
 	if index != len(data) {
-		panic("deserialize failed")
+		return &DeserializeError{Err: fmt.Errorf("deserialize failed: %d unread bytes after offset %d", len(data)-index, index)}
 	}
+	return nil
+}
+
+// checkRemaining returns an error if fewer than n bytes of data remain at index.
+func checkRemaining(data []byte, index int, n int) error {
+	if n < 0 || n > len(data)-index {
+		return fmt.Errorf("unexpected end of data at offset %d: expected %d bytes, got %d", index, n, len(data)-index)
+	}
+	return nil
 }
 
 func deserializeData(data []byte, v reflect.Value, index int) (int, error) {
 	switch v.Kind() {
 	case reflect.Bool:
+		if err := checkRemaining(data, index, 1); err != nil {
+			return index, err
+		}
 		v.SetBool(data[index] == 1)
 		return index + 1, nil
 	case reflect.Int8:
+		if err := checkRemaining(data, index, 1); err != nil {
+			return index, err
+		}
 		v.SetInt(int64(int8(data[index])))
 		return index + 1, nil
 	case reflect.Uint8:
+		if err := checkRemaining(data, index, 1); err != nil {
+			return index, err
+		}
 		v.SetUint(uint64(data[index]))
 		return index + 1, nil
 	case reflect.Int16:
+		if err := checkRemaining(data, index, 2); err != nil {
+			return index, err
+		}
 		b := []byte{data[index], data[index+1]}
 		a := binary.LittleEndian.Uint16(b)
 		v.SetInt(int64(int16(a)))
 		return index + 2, nil
 	case reflect.Uint16:
+		if err := checkRemaining(data, index, 2); err != nil {
+			return index, err
+		}
 		b := []byte{data[index], data[index+1]}
 		a := binary.LittleEndian.Uint16(b)
 		v.SetUint(uint64(a))
 		return index + 2, nil
 	case reflect.Int32:
+		if err := checkRemaining(data, index, 4); err != nil {
+			return index, err
+		}
 		b := []byte{data[index], data[index+1], data[index+2], data[index+3]}
 		a := binary.LittleEndian.Uint32(b)
 		v.SetInt(int64(int32(a)))
 		return index + 4, nil
 	case reflect.Uint32:
+		if err := checkRemaining(data, index, 4); err != nil {
+			return index, err
+		}
 		b := []byte{data[index], data[index+1], data[index+2], data[index+3]}
 		a := binary.LittleEndian.Uint32(b)
 		v.SetUint(uint64(a))
 		return index + 4, nil
 	case reflect.Int64:
+		if err := checkRemaining(data, index, 8); err != nil {
+			return index, err
+		}
 		b := []byte{data[index], data[index+1], data[index+2], data[index+3],
 			data[index+4], data[index+5], data[index+6], data[index+7]}
 		a := binary.LittleEndian.Uint64(b)
 		v.SetInt(int64(a))
 		return index + 8, nil
 	case reflect.Uint64:
+		if err := checkRemaining(data, index, 8); err != nil {
+			return index, err
+		}
 		b := []byte{data[index], data[index+1], data[index+2], data[index+3],
 			data[index+4], data[index+5], data[index+6], data[index+7]}
 		a := binary.LittleEndian.Uint64(b)
 		v.SetUint(a)
 		return index + 8, nil
 	case reflect.Slice:
+		if err := checkRemaining(data, index, 8); err != nil {
+			return index, err
+		}
 		b := []byte{data[index], data[index+1], data[index+2], data[index+3],
 			data[index+4], data[index+5], data[index+6], data[index+7]}
 
@@ -85,11 +147,14 @@ func deserializeData(data []byte, v reflect.Value, index int) (int, error) {
 		index += 8
 		switch v.Type().Elem().Kind() {
 		case reflect.Uint8:
+			if err := checkRemaining(data, index, int(length)); err != nil {
+				return index, err
+			}
 			bytes := data[index : index+int(length)]
 			v.SetBytes(bytes)
 			return index + int(length), nil
 		}
-		return index, fmt.Errorf("unsupport type: %v, elem: %v", v.Kind(), v.Elem().Kind())
+		return index, fmt.Errorf("unsupport type: %v, elem: %v", v.Kind(), v.Type().Elem().Kind())
 	case reflect.Array:
 		for i := 0; i < v.Len(); i++ {
 			var err error
@@ -100,23 +165,39 @@ func deserializeData(data []byte, v reflect.Value, index int) (int, error) {
 		}
 		return index, nil
 	case reflect.String:
+		if err := checkRemaining(data, index, 8); err != nil {
+			return index, err
+		}
 		b := []byte{data[index], data[index+1], data[index+2], data[index+3],
 			data[index+4], data[index+5], data[index+6], data[index+7]}
 		l := binary.LittleEndian.Uint64(b)
 		index += 8
 		length := int(l)
+		if err := checkRemaining(data, index, length); err != nil {
+			return index, err
+		}
 		str := make([]byte, length)
 		copy(str[:], data[index:index+length])
 		v.SetString(string(str))
 		return index + length, nil
 	case reflect.Ptr:
+		if err := checkRemaining(data, index, 1); err != nil {
+			return index, err
+		}
 		if data[index] == 0 {
 			v.SetZero()
 			return index + 1, nil
 		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
 		return deserializeData(data, v.Elem(), index+1)
 	case reflect.Struct:
 		for i := 0; i < v.NumField(); i++ {
+			// Unexported fields are not serialized, see SerializeData.
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
 			field := v.Field(i)
 			var err error
 			index, err = deserializeData(data, field, index)
@@ -125,6 +206,31 @@ func deserializeData(data []byte, v reflect.Value, index int) (int, error) {
 			}
 		}
 		return index, nil
+	case reflect.Map:
+		if err := checkRemaining(data, index, 8); err != nil {
+			return index, err
+		}
+		length := binary.LittleEndian.Uint64(data[index : index+8])
+		index += 8
+		// Each entry takes at least one byte, which bounds a bogus length before allocating.
+		if err := checkRemaining(data, index, int(min(length, uint64(len(data))+1))); err != nil {
+			return index, err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), int(length))
+		for i := uint64(0); i < length; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			elem := reflect.New(v.Type().Elem()).Elem()
+			var err error
+			if index, err = deserializeData(data, key, index); err != nil {
+				return index, err
+			}
+			if index, err = deserializeData(data, elem, index); err != nil {
+				return index, err
+			}
+			m.SetMapIndex(key, elem)
+		}
+		v.Set(m)
+		return index, nil
 	}
 	return index, fmt.Errorf("unsupport type: %v", v.Kind())
 }
@@ -0,0 +1,26 @@
+//go:build !mipsle
+// +build !mipsle
+
+package zkvm_runtime
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// ComputePublicValuesDigest recomputes on the host the words a guest commits in RuntimeExit with
+// the default SHA256 PublicValuesHasher, after passing each of values to CommitBytes in order.
+// Values committed with Commit are passed as their MustSerializeData encoding.
+func ComputePublicValuesDigest(values [][]byte) [8]uint32 {
+	h := sha256.New()
+	for _, value := range values {
+		_, _ = h.Write(padToWord(value))
+	}
+	hashBytes := h.Sum(nil)
+
+	var words [8]uint32
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint32(hashBytes[i*4 : (i+1)*4])
+	}
+	return words
+}
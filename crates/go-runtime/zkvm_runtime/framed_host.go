@@ -0,0 +1,35 @@
+//go:build !mipsle
+// +build !mipsle
+
+package zkvm_runtime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ReadFramedCommits splits a public values stream written only by CommitFramed back into the
+// committed payloads, in commit order.
+func ReadFramedCommits(r io.Reader) ([][]byte, error) {
+	var payloads [][]byte
+	for {
+		var length [4]byte
+		if _, err := io.ReadFull(r, length[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return payloads, nil
+			}
+			return nil, fmt.Errorf("frame %d: truncated length word: %w", len(payloads), err)
+		}
+		n := int64(binary.LittleEndian.Uint32(length[:]))
+
+		// Copy rather than allocate up front, so a corrupt length cannot exhaust memory.
+		var payload bytes.Buffer
+		if _, err := io.CopyN(&payload, r, (n+3)/4*4); err != nil {
+			return nil, fmt.Errorf("frame %d: truncated payload of %d bytes: %w", len(payloads), n, err)
+		}
+		payloads = append(payloads, payload.Bytes()[:n])
+	}
+}
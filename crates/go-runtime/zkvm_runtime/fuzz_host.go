@@ -0,0 +1,46 @@
+//go:build !mipsle
+// +build !mipsle
+
+package zkvm_runtime
+
+import "fmt"
+
+// fuzzTarget deserializes into a fresh T.
+func fuzzTarget[T any](data []byte) error {
+	var value T
+	return TryDeserializeData(data, &value)
+}
+
+// fuzzTargets are the types FuzzDeserialize decodes into, by type ID: the shapes read by the
+// sample guests, then one of each composite kind the deserializer supports.
+var fuzzTargets = []func(data []byte) error{
+	fuzzTarget[uint32], // examples/simple-go
+	fuzzTarget[uint64],
+	fuzzTarget[bool],
+	fuzzTarget[[]byte],
+	fuzzTarget[string],
+	fuzzTarget[[32]byte],
+	fuzzTarget[*uint64],
+	fuzzTarget[map[string]uint32],
+	fuzzTarget[struct {
+		Flag  bool
+		Count int64
+		Data  []byte
+		Name  string
+		Next  *int16
+		Tags  map[uint8]string
+	}],
+}
+
+// FuzzTypeCount is the number of type IDs accepted by FuzzDeserialize.
+var FuzzTypeCount = len(fuzzTargets)
+
+// FuzzDeserialize deserializes arbitrary hint bytes into the type registered under typeID, in
+// [0, FuzzTypeCount), as Read would. Malformed data is reported as an error; any panic is a bug
+// in the deserializer.
+func FuzzDeserialize(data []byte, typeID int) error {
+	if typeID < 0 || typeID >= len(fuzzTargets) {
+		return fmt.Errorf("unknown fuzz type id %d", typeID)
+	}
+	return fuzzTargets[typeID](data)
+}
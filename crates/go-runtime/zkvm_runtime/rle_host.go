@@ -0,0 +1,54 @@
+//go:build !mipsle
+// +build !mipsle
+
+package zkvm_runtime
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"slices"
+)
+
+// MaxRLELen is the largest number of values DecodeRLE expands committed runs into, so that a
+// few bytes claiming a huge run length cannot exhaust the host's memory.
+var MaxRLELen = 1 << 24
+
+// DecodeRLE expands the bytes committed by CommitRLE back into the original values. It fails if
+// the runs expand to more than MaxRLELen values.
+func DecodeRLE[T any](data []byte) ([]T, error) {
+	if err := checkRemaining(data, 0, 8); err != nil {
+		return nil, err
+	}
+	runs := binary.LittleEndian.Uint64(data)
+	index := 8
+
+	var values []T
+	for i := uint64(0); i < runs; i++ {
+		if err := checkRemaining(data, index, 8); err != nil {
+			return nil, fmt.Errorf("run %d: %w", i, err)
+		}
+		count := binary.LittleEndian.Uint64(data[index:])
+		index += 8
+		if count == 0 {
+			return nil, fmt.Errorf("run %d: invalid run length %d", i, count)
+		}
+		if count > uint64(MaxRLELen-len(values)) {
+			return nil, fmt.Errorf("run %d: run length %d expands past MaxRLELen (%d values)", i, count, MaxRLELen)
+		}
+
+		var value T
+		var err error
+		if index, err = deserializeData(data, reflect.ValueOf(&value).Elem(), index); err != nil {
+			return nil, fmt.Errorf("run %d: %w", i, err)
+		}
+		values = slices.Grow(values, int(count))
+		for ; count > 0; count-- {
+			values = append(values, value)
+		}
+	}
+	if index != len(data) {
+		return nil, fmt.Errorf("%d unread bytes after %d runs", len(data)-index, runs)
+	}
+	return values, nil
+}
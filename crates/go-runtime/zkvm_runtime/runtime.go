@@ -1,63 +1,455 @@
-//go:build mipsle
-// +build mipsle
-
 package zkvm_runtime
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/sha256"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"hash"
 	"reflect"
+	"sync"
 	"unsafe"
 )
 
-func SyscallWrite(fd int, write_buf []byte, nbytes int) int
-func SyscallHintLen() int
-func SyscallHintRead(ptr []byte, len int)
-func SyscallCommit(index int, word uint32)
-func SyscallExit(code int)
-func SyscallKeccakSponge(input unsafe.Pointer, result unsafe.Pointer)
-
 var PublicValuesHasher hash.Hash = sha256.New()
 
-const EMBEDDED_RESERVED_INPUT_REGION_SIZE int = 1024 * 1024 * 1024
-const MAX_MEMORY int = 0x7f000000
+// PV_DIGEST_NUM_WORDS is the number of words of the public values digest, which is all the
+// executor's committed_value_digest holds.
+const PV_DIGEST_NUM_WORDS = 8
+
+// publicValuesMu serializes access to PublicValuesHasher and the public values fd, so that
+// commits from concurrent goroutines are hashed and written whole and in the same order.
+var publicValuesMu sync.Mutex
+
+// SetPublicValuesHasher replaces the hasher that accumulates committed public values, e.g. with
+// NewKeccak256Hasher for verifiers that expect a Keccak256 digest. It must be called before the
+// first Commit, and h must produce a 32 byte digest, the PV_DIGEST_NUM_WORDS words RuntimeExit
+// commits.
+func SetPublicValuesHasher(h hash.Hash) {
+	if h.Size() != PV_DIGEST_NUM_WORDS*4 {
+		panic(fmt.Sprintf("public values hasher produces %d bytes, %d are required", h.Size(), PV_DIGEST_NUM_WORDS*4))
+	}
+	publicValuesMu.Lock()
+	defer publicValuesMu.Unlock()
+	PublicValuesHasher = h
+}
+
+// EMBEDDED_RESERVED_INPUT_REGION_SIZE and MAX_MEMORY describe the memory map of the default VM
+// configuration. Use Configure to change them.
+var EMBEDDED_RESERVED_INPUT_REGION_SIZE int = 1024 * 1024 * 1024
+var MAX_MEMORY int = 0x7f000000
 
 var RESERVED_INPUT_PTR int = MAX_MEMORY - EMBEDDED_RESERVED_INPUT_REGION_SIZE
 
+// MemoryConfig is the memory map of a VM configuration, as passed to Configure.
+type MemoryConfig struct {
+	// MaxMemory is the end of the addressable memory.
+	MaxMemory int
+	// ReservedInputRegionSize is the size of the region below MaxMemory that hints are copied
+	// into.
+	ReservedInputRegionSize int
+}
+
+// Configure replaces the memory map of the default VM configuration and rewinds the reserved
+// input region to its new start. It must be called before the first hint is read, typically from
+// an init function, and panics otherwise or if config is not a valid memory map.
+func Configure(config MemoryConfig) {
+	if used, _ := ReservedInputUsage(); used != 0 {
+		panic("zkvm_runtime: Configure called after hints were read")
+	}
+	if config.ReservedInputRegionSize <= 0 || config.MaxMemory < config.ReservedInputRegionSize {
+		panic(fmt.Sprintf("zkvm_runtime: invalid memory config %+v", config))
+	}
+	if (config.MaxMemory-config.ReservedInputRegionSize)%readHintAlign != 0 {
+		panic(fmt.Sprintf("zkvm_runtime: reserved input region of %+v is not %d byte aligned", config, readHintAlign))
+	}
+	MAX_MEMORY = config.MaxMemory
+	EMBEDDED_RESERVED_INPUT_REGION_SIZE = config.ReservedInputRegionSize
+	RESERVED_INPUT_PTR = MAX_MEMORY - EMBEDDED_RESERVED_INPUT_REGION_SIZE
+}
+
+// ReservedInputUsage returns how many bytes of the reserved input region the hints read so far
+// occupy, including alignment padding, and the size of the region.
+func ReservedInputUsage() (used int, total int) {
+	return RESERVED_INPUT_PTR - (MAX_MEMORY - EMBEDDED_RESERVED_INPUT_REGION_SIZE), EMBEDDED_RESERVED_INPUT_REGION_SIZE
+}
+
+// ResetPublicValues discards the public values committed so far and rewinds the reserved input
+// region, so independent executions within one process do not share state. The hasher selected
+// with SetPublicValuesHasher is kept.
+func ResetPublicValues() {
+	publicValuesMu.Lock()
+	defer publicValuesMu.Unlock()
+	PublicValuesHasher.Reset()
+	RESERVED_INPUT_PTR = MAX_MEMORY - EMBEDDED_RESERVED_INPUT_REGION_SIZE
+}
+
+// Exit codes of the runtime traps. Tooling reporting a failed execution should match on these
+// rather than on the integers.
+const (
+	// READ_OOM_EXIT_CODE is the exit code used when the hints read by a program no longer fit in
+	// the EMBEDDED_RESERVED_INPUT_REGION_SIZE bytes reserved below MAX_MEMORY.
+	READ_OOM_EXIT_CODE int = 0x52
+
+	// INVALID_DIGEST_EXIT_CODE is the exit code used when the public values digest is not
+	// PV_DIGEST_NUM_WORDS words long and cannot be committed.
+	INVALID_DIGEST_EXIT_CODE int = 0x53
+
+	// DESERIALIZE_EXIT_CODE is the exit code used by Guard when the guarded function panics with
+	// a DeserializeError, i.e. a hint could not be decoded.
+	DESERIALIZE_EXIT_CODE int = 0x54
+
+	// HINT_TOO_LARGE_EXIT_CODE is the exit code used when the length of the next hint is
+	// negative or over the limit set by MaxHintLen.
+	HINT_TOO_LARGE_EXIT_CODE int = 0x55
+
+	// PANIC_EXIT_CODE is the exit code used by Guard when the guarded function panics.
+	PANIC_EXIT_CODE int = 101
+)
+
+// Read deserializes the next hint into a T. Hints are copied into the reserved input region,
+// and the program exits with READ_OOM_EXIT_CODE once that region is exhausted.
 func Read[T any]() T {
+	result, err := TryRead[T]()
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// TryRead is Read returning an error, instead of panicking, when the next hint cannot be
+// deserialized into a T.
+func TryRead[T any]() (T, error) {
+	var result T
+	if err := TryDeserializeData(readHint(), &result); err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// ReadInto deserializes the next hint into out, overwriting its current value. It avoids the
+// copy of the returned value made by Read when the same variable is filled repeatedly.
+func ReadInto[T any](out *T) {
+	DeserializeData(readHint(), out)
+}
+
+// ReadVec reads a uint32 count hint followed by that many T hints and returns them as a slice.
+// The VM delivers each hint in a single syscall, so every element is read with its own length.
+func ReadVec[T any]() []T {
+	count := Read[uint32]()
+	result := make([]T, count)
+	for i := range result {
+		ReadInto(&result[i])
+	}
+	return result
+}
+
+// ReadBytes reads a hint holding a serialized []byte, i.e. a little-endian uint64 length and the
+// bytes, and returns the bytes without going through the reflection based deserializer. The
+// returned slice aliases the reserved input region.
+func ReadBytes() []byte {
+	data := readHint()
+	if err := checkRemaining(data, 0, 8); err != nil {
+		panic(&DeserializeError{Err: err})
+	}
+	length := binary.LittleEndian.Uint64(data[:8])
+	if length != uint64(len(data)-8) {
+		panic(&DeserializeError{Err: fmt.Errorf("byte hint of %d bytes declares a %d byte payload", len(data), length)})
+	}
+	return data[8:]
+}
+
+// ReadTagged reads one framed message: a single hint holding a tag byte, a little-endian uint64
+// payload length and the payload. The returned payload aliases the reserved input region.
+func ReadTagged() (tag byte, payload []byte) {
+	data := readHint()
+	if err := checkRemaining(data, 0, 9); err != nil {
+		panic(&DeserializeError{Err: err})
+	}
+	length := binary.LittleEndian.Uint64(data[1:9])
+	if length != uint64(len(data)-9) {
+		panic(&DeserializeError{Err: fmt.Errorf("tagged message of %d bytes declares a %d byte payload", len(data), length)})
+	}
+	return data[0], data[9:]
+}
+
+// readHintAlign is the alignment of every hint in the reserved input region, the largest
+// alignment of any Go type on mipsle (int64, uint64 and float64).
+const readHintAlign = 8
+
+// MaxHintLen is the largest hint, in bytes, that the Read functions accept, or 0 for
+// EMBEDDED_RESERVED_INPUT_REGION_SIZE. A longer hint exits with HINT_TOO_LARGE_EXIT_CODE before
+// any of the reserved input region is used, bounding what a faulty or malicious prover can make
+// the program reserve.
+var MaxHintLen = 0
+
+// maxHintLen returns the limit set by MaxHintLen.
+func maxHintLen() int {
+	if MaxHintLen > 0 {
+		return MaxHintLen
+	}
+	return EMBEDDED_RESERVED_INPUT_REGION_SIZE
+}
+
+// readHint copies the next hint into the reserved input region and returns its bytes. The bytes
+// start at a multiple of readHintAlign, so they can be reinterpreted as any Go type.
+func readHint() []byte {
 	len := SyscallHintLen()
+	if len < 0 || len > maxHintLen() {
+		SyscallExit(HINT_TOO_LARGE_EXIT_CODE)
+	}
 	var value []byte
-	capacity := (len + 3) / 4 * 4
-	addr := RESERVED_INPUT_PTR
-	RESERVED_INPUT_PTR += capacity
-	ptr := unsafe.Pointer(uintptr(addr))
-	value = unsafe.Slice((*byte)(ptr), capacity)
-	var result T
+	addr := (RESERVED_INPUT_PTR + readHintAlign - 1) &^ (readHintAlign - 1)
+	// int is 32 bits on mipsle, so compare against the space left rather than summing past
+	// MAX_MEMORY, which could wrap.
+	if len > MAX_MEMORY-addr {
+		SyscallExit(READ_OOM_EXIT_CODE)
+	}
+	capacity := (len + readHintAlign - 1) &^ (readHintAlign - 1)
+	if capacity > MAX_MEMORY-addr {
+		SyscallExit(READ_OOM_EXIT_CODE)
+	}
+	RESERVED_INPUT_PTR = addr + capacity
+	value = reservedInput(addr, capacity)
 	SyscallHintRead(value, len)
-	DeserializeData(value[0:len], &result)
-	return result
+	return value[0:len]
 }
 
 func Commit[T any](value T) {
-	bytes := MustSerializeData(value)
-	length := len(bytes)
-	if (length & 3) != 0 {
-		d := make([]byte, 4-(length&3))
-		bytes = append(bytes, d...)
+	CommitBytes(MustSerializeData(value))
+}
+
+// CommitTo commits value like Commit, but writes it to fd instead of the public values fd, for
+// VM configurations that route another public channel to fd. It still feeds the single
+// PublicValuesHasher, so the digest covers the commits to every fd in call order.
+func CommitTo[T any](fd int, value T) {
+	commitBytesTo(fd, MustSerializeData(value))
+}
+
+// CommitAll commits each of values exactly like a sequence of Commit calls, but feeds
+// PublicValuesHasher and the public values fd with a single write each.
+func CommitAll(values ...any) {
+	var hashed, written bytes.Buffer
+	for _, value := range values {
+		b := MustSerializeData(value)
+		written.Write(b)
+		hashed.Write(padToWord(b))
+	}
+
+	publicValuesMu.Lock()
+	defer publicValuesMu.Unlock()
+	_, _ = PublicValuesHasher.Write(hashed.Bytes())
+
+	SyscallWrite(13, written.Bytes(), written.Len())
+}
+
+// CommitRLE commits values run-length encoded, as a single CommitBytes of the bincode encoding
+// of a Vec<(u64, T)> holding the length and value of each run of equal consecutive values.
+// DecodeRLE expands the committed bytes back into values.
+func CommitRLE[T comparable](values []T) {
+	type run struct {
+		count uint64
+		value T
+	}
+	var runs []run
+	for _, value := range values {
+		if len(runs) > 0 && runs[len(runs)-1].value == value {
+			runs[len(runs)-1].count++
+			continue
+		}
+		runs = append(runs, run{1, value})
 	}
 
-	_, _ = PublicValuesHasher.Write(bytes)
+	var buf bytes.Buffer
+	buf.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(runs))))
+	for _, r := range runs {
+		buf.Write(binary.LittleEndian.AppendUint64(nil, r.count))
+		if err := serializeTo(&buf, reflect.ValueOf(r.value)); err != nil {
+			panic(err)
+		}
+	}
+	CommitBytes(buf.Bytes())
+}
+
+// CommitU32, CommitU64, CommitI32 and CommitI64 commit an integer of a fixed width, little
+// endian, exactly like Commit of the same typed value but without going through the reflection
+// based serializer. Commit rejects int and uint, whose width differs between the VM and the host;
+// convert such values and use one of these instead.
+func CommitU32(v uint32) {
+	CommitBytes(binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func CommitU64(v uint64) {
+	CommitBytes(binary.LittleEndian.AppendUint64(nil, v))
+}
 
-	SyscallWrite(13, bytes, length)
+func CommitI32(v int32) {
+	CommitU32(uint32(v))
+}
+
+func CommitI64(v int64) {
+	CommitU64(uint64(v))
+}
+
+// CommitArray32 commits a 32 byte value, typically a digest, exactly like Commit([32]byte) but
+// without going through the reflection based serializer. It is already word aligned.
+func CommitArray32(v [32]byte) {
+	publicValuesMu.Lock()
+	defer publicValuesMu.Unlock()
+	_, _ = PublicValuesHasher.Write(v[:])
+
+	SyscallWrite(13, v[:], len(v))
+}
+
+// CommitAndBytes commits value like Commit and returns its serialization, padded to a word
+// boundary exactly as it was hashed. The slice is freshly allocated for each call and owned by
+// the caller, so it can be hashed again in-program without serializing value twice.
+func CommitAndBytes[T any](value T) []byte {
+	b := MustSerializeData(value)
+	CommitBytes(b)
+	return padToWord(b)
+}
+
+// padToWord returns b zero-padded to a multiple of 4 bytes. An already aligned b is returned as
+// is; otherwise the padding goes into a copy and b is left untouched.
+func padToWord(b []byte) []byte {
+	if len(b)&3 == 0 {
+		return b
+	}
+	padded := make([]byte, (len(b)+3)/4*4)
+	copy(padded, b)
+	return padded
+}
+
+// CommitBytes commits b as is, without serializing it. Like Commit it pads b to a word boundary
+// before feeding it to PublicValuesHasher.
+func CommitBytes(b []byte) {
+	commitBytesTo(13, b)
+}
+
+// commitBytesTo is CommitBytes writing to fd.
+func commitBytesTo(fd int, b []byte) {
+	length := len(b)
+	b = padToWord(b)
+
+	publicValuesMu.Lock()
+	defer publicValuesMu.Unlock()
+	_, _ = PublicValuesHasher.Write(b)
+
+	SyscallWrite(fd, b, length)
+}
+
+// CommitFramed commits b behind a little-endian uint32 length word. Unlike CommitBytes the payload
+// is zero-padded to a word boundary in the public values stream as well as in the hash, so that a
+// stream of framed commits can be split back into its payloads with ReadFramedCommits.
+func CommitFramed(b []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(b)))
+	payload := padToWord(b)
+
+	publicValuesMu.Lock()
+	defer publicValuesMu.Unlock()
+	_, _ = PublicValuesHasher.Write(length[:])
+	_, _ = PublicValuesHasher.Write(payload)
+
+	SyscallWrite(13, length[:], len(length))
+	SyscallWrite(13, payload, len(payload))
+}
+
+// commitStreamChunkSize is the number of bytes CommitStream hashes and writes at a time.
+const commitStreamChunkSize = 4096
+
+// commitWriter feeds everything written to it into PublicValuesHasher and the public values fd.
+type commitWriter struct {
+	length int
+}
+
+func (w *commitWriter) Write(p []byte) (int, error) {
+	_, _ = PublicValuesHasher.Write(p)
+	SyscallWrite(13, p, len(p))
+	w.length += len(p)
+	return len(p), nil
+}
+
+// CommitStream commits value like Commit, but serializes it in chunks of commitStreamChunkSize
+// bytes instead of materializing it, so large outputs are not held in memory twice. The digest
+// is identical to Commit of the same value.
+func CommitStream[T any](value T) {
+	publicValuesMu.Lock()
+	defer publicValuesMu.Unlock()
+
+	committed := &commitWriter{}
+	w := bufio.NewWriterSize(committed, commitStreamChunkSize)
+	if err := serializeTo(w, reflect.ValueOf(value)); err != nil {
+		panic(err)
+	}
+	w.Flush()
+
+	// Only the padding of the trailing partial word is left to hash.
+	tail := committed.length & 3
+	_, _ = PublicValuesHasher.Write(padToWord(make([]byte, tail))[tail:])
+}
+
+// DebugLogging enables Log. It is off by default so that release guests pay nothing for their
+// debug output.
+var DebugLogging = false
+
+// Log writes msg to stderr when DebugLogging is set. Unlike Commit it does not feed
+// PublicValuesHasher, so debug output never changes the public values digest.
+func Log(msg string) {
+	if !DebugLogging || len(msg) == 0 {
+		return
+	}
+	SyscallWrite(2, []byte(msg), len(msg))
+}
+
+// Guard runs fn and turns a panic into a deterministic exit, logging the panic value first. A
+// DeserializeError exits with DESERIALIZE_EXIT_CODE and any other panic with PANIC_EXIT_CODE.
+// Guest programs wrap their main logic with it so a failure surfaces as an exit code the prover
+// can report.
+func Guard(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			if isSyscallExit(r) {
+				panic(r)
+			}
+			Log(fmt.Sprintf("panic: %v\n", r))
+			var deserializeErr *DeserializeError
+			if err, ok := r.(error); ok && errors.As(err, &deserializeErr) {
+				SyscallExit(DESERIALIZE_EXIT_CODE)
+			}
+			SyscallExit(PANIC_EXIT_CODE)
+		}
+	}()
+	fn()
+}
+
+// Assert exits with code when cond is false, after committing reason with CommitBytes. The exit
+// goes through RuntimeExit, so the reason is covered by the committed public values digest and a
+// verifier can rely on it. When cond is true it does nothing.
+func Assert(cond bool, code int, reason string) {
+	if cond {
+		return
+	}
+	CommitBytes([]byte(reason))
+	RuntimeExit(code)
 }
 
 //go:linkname RuntimeExit zkvm.RuntimeExit
 func RuntimeExit(code int) {
+	// The lock is held until exit so that no commit can follow the committed digest.
+	publicValuesMu.Lock()
+	defer publicValuesMu.Unlock()
 	hashBytes := PublicValuesHasher.Sum(nil)
+	if len(hashBytes) != PV_DIGEST_NUM_WORDS*4 {
+		SyscallExit(INVALID_DIGEST_EXIT_CODE)
+	}
 
 	// 2. COMMIT each u32 word
-	for i := 0; i < 8; i++ {
+	for i := 0; i < PV_DIGEST_NUM_WORDS; i++ {
 		word := binary.LittleEndian.Uint32(hashBytes[i*4 : (i+1)*4])
 		SyscallCommit(i, word)
 	}
@@ -127,6 +519,39 @@ func Keccak256(data []byte) [32]byte {
 	return result
 }
 
+// keccak256Hasher is a hash.Hash over Keccak256. The sponge syscall absorbs a whole message at
+// once, so written data is buffered until Sum.
+type keccak256Hasher struct {
+	data []byte
+}
+
+// NewKeccak256Hasher returns a hash.Hash computing Keccak256 with the zkVM keccak precompile.
+func NewKeccak256Hasher() hash.Hash {
+	return &keccak256Hasher{}
+}
+
+func (h *keccak256Hasher) Write(p []byte) (int, error) {
+	h.data = append(h.data, p...)
+	return len(p), nil
+}
+
+func (h *keccak256Hasher) Sum(b []byte) []byte {
+	digest := Keccak256(h.data)
+	return append(b, digest[:]...)
+}
+
+func (h *keccak256Hasher) Reset() {
+	h.data = h.data[:0]
+}
+
+func (h *keccak256Hasher) Size() int {
+	return 32
+}
+
+func (h *keccak256Hasher) BlockSize() int {
+	return 136
+}
+
 func init() {
 	// Explicit reference, prevent optimization
 	_ = reflect.ValueOf(RuntimeExit)
@@ -0,0 +1,189 @@
+//go:build !mipsle
+// +build !mipsle
+
+package zkvm_runtime
+
+import (
+	"fmt"
+	"math/bits"
+	"unsafe"
+)
+
+// The host build replaces the zkVM syscalls with in-memory buffers so that Read, Commit and the
+// serialization plumbing can be exercised by `go test`.
+
+// stubExit is the panic value SyscallExit uses to stop the caller, as the VM would.
+type stubExit struct {
+	code int
+}
+
+var (
+	// stubHints is the queue of hints returned by SyscallHintLen/SyscallHintRead.
+	stubHints [][]byte
+	// stubWrites holds the bytes written to each fd.
+	stubWrites = map[int][]byte{}
+	// stubCommits holds the words committed by SyscallCommit, by index.
+	stubCommits = map[int]uint32{}
+	// stubCommitOrder holds the indices passed to SyscallCommit, in call order.
+	stubCommitOrder []int
+	// stubExitCode is the code passed to the last SyscallExit, or -1.
+	stubExitCode = -1
+	// stubHintLen, if set, replaces the length SyscallHintLen reports for the next hint.
+	stubHintLen func() int
+)
+
+// resetStub clears all of the in-memory syscall state.
+func resetStub() {
+	stubHints = nil
+	stubWrites = map[int][]byte{}
+	stubCommits = map[int]uint32{}
+	stubCommitOrder = nil
+	stubExitCode = -1
+	stubHintLen = nil
+}
+
+// ReplayResult is what a guest run under ReplayHints produced.
+type ReplayResult struct {
+	// PublicValues holds the bytes committed to the public values fd.
+	PublicValues []byte
+	// ExitCode is the code passed to SyscallExit, or -1 if run returned normally.
+	ExitCode int
+	// Commits holds the digest words committed by RuntimeExit, by index.
+	Commits map[int]uint32
+}
+
+// ReplayHints runs guest logic on the host against the given hint sequence, which the Read
+// functions consume in order, and returns what it committed. The syscall stub and the public
+// values state are reset first. As the stub is global, replays must not run concurrently.
+func ReplayHints(inputs [][]byte, run func()) (result ReplayResult) {
+	resetStub()
+	ResetPublicValues()
+	stubHints = append(stubHints, inputs...)
+
+	defer func() {
+		if r := recover(); r != nil {
+			exit, ok := r.(stubExit)
+			if !ok {
+				panic(r)
+			}
+			result.ExitCode = exit.code
+		}
+		result.PublicValues = stubWrites[13]
+		result.Commits = stubCommits
+	}()
+	result.ExitCode = -1
+	run()
+	return result
+}
+
+func SyscallWrite(fd int, write_buf []byte, nbytes int) int {
+	stubWrites[fd] = append(stubWrites[fd], write_buf[:nbytes]...)
+	return nbytes
+}
+
+func SyscallHintLen() int {
+	if stubHintLen != nil {
+		return stubHintLen()
+	}
+	if len(stubHints) == 0 {
+		panic("no hints queued")
+	}
+	return len(stubHints[0])
+}
+
+func SyscallHintRead(ptr []byte, len int) {
+	if SyscallHintLen() != len {
+		panic(fmt.Sprintf("hint read of %d bytes, next hint has %d", len, SyscallHintLen()))
+	}
+	copy(ptr, stubHints[0])
+	stubHints = stubHints[1:]
+}
+
+func SyscallCommit(index int, word uint32) {
+	// The executor traps on a word past its committed_value_digest.
+	if index < 0 || index >= PV_DIGEST_NUM_WORDS {
+		panic(fmt.Sprintf("commit of public values digest word %d out of range", index))
+	}
+	stubCommits[index] = word
+	stubCommitOrder = append(stubCommitOrder, index)
+}
+
+func SyscallExit(code int) {
+	stubExitCode = code
+	panic(stubExit{code})
+}
+
+// isSyscallExit reports whether a recovered panic value came from SyscallExit.
+func isSyscallExit(r any) bool {
+	_, ok := r.(stubExit)
+	return ok
+}
+
+// SyscallKeccakSponge absorbs the padded input built by Keccak256: blocks of 34 rate words
+// followed by 2 zero words, with the total word count in result[16].
+func SyscallKeccakSponge(input unsafe.Pointer, result unsafe.Pointer) {
+	out := (*[17]uint32)(result)
+	words := unsafe.Slice((*uint32)(input), out[16])
+
+	var state [25]uint64
+	for block := 0; block+36 <= len(words); block += 36 {
+		for i := 0; i < 17; i++ {
+			state[i] ^= uint64(words[block+2*i]) | uint64(words[block+2*i+1])<<32
+		}
+		keccakF1600(&state)
+	}
+	for i := 0; i < 8; i++ {
+		out[2*i] = uint32(state[i])
+		out[2*i+1] = uint32(state[i] >> 32)
+	}
+}
+
+// reservedInput returns a fresh buffer standing in for the reserved input region.
+func reservedInput(addr int, capacity int) []byte {
+	return make([]byte, capacity)
+}
+
+var keccakRoundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+var keccakRotations = [25]int{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+// keccakF1600 is the Keccak-f[1600] permutation with lanes indexed as x + 5*y.
+func keccakF1600(a *[25]uint64) {
+	var b [25]uint64
+	var c, d [5]uint64
+	for round := 0; round < 24; round++ {
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			d[x] = c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+		}
+		for i := 0; i < 25; i++ {
+			a[i] ^= d[i%5]
+		}
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y+5*((2*x+3*y)%5)] = bits.RotateLeft64(a[x+5*y], keccakRotations[x+5*y])
+			}
+		}
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				a[x+5*y] = b[x+5*y] ^ (^b[(x+1)%5+5*y] & b[(x+2)%5+5*y])
+			}
+		}
+		a[0] ^= keccakRoundConstants[round]
+	}
+}
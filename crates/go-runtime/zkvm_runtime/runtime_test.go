@@ -0,0 +1,1167 @@
+//go:build !mipsle
+// +build !mipsle
+
+package zkvm_runtime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type testValue struct {
+	A uint32
+	B []byte
+	C string
+}
+
+// setupStub resets the syscall stub and the runtime state for a single test.
+func setupStub(t *testing.T) {
+	t.Helper()
+	resetStub()
+	PublicValuesHasher = sha256.New()
+	ResetPublicValues()
+	t.Cleanup(resetStub)
+}
+
+// exitCode runs fn and returns the code it passed to SyscallExit, or -1 if it returned normally.
+func exitCode(t *testing.T, fn func()) (code int) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			exit, ok := r.(stubExit)
+			if !ok {
+				panic(r)
+			}
+			code = exit.code
+		}
+	}()
+	fn()
+	return -1
+}
+
+func TestReadRoundTrip(t *testing.T) {
+	setupStub(t)
+
+	expected := testValue{A: 7, B: []byte{1, 2, 3}, C: "zkm"}
+	stubHints = append(stubHints, MustSerializeData(expected))
+
+	actual := Read[testValue]()
+	if actual.A != expected.A || !bytes.Equal(actual.B, expected.B) || actual.C != expected.C {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestSerializeValueRoundTrip(t *testing.T) {
+	type hintInput struct {
+		Value testValue
+		Next  *testValue
+		Tags  map[string]uint64
+	}
+	expected := hintInput{
+		Value: testValue{A: 1, B: []byte{2}, C: "three"},
+		Next:  &testValue{A: 4, B: []byte{}, C: ""},
+		Tags:  map[string]uint64{"a": 1, "b": 2},
+	}
+	serialized, err := SerializeValue(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual hintInput
+	if err := TryDeserializeData(serialized, &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual.Value.A != 1 || actual.Value.C != "three" || actual.Next == nil || actual.Next.A != 4 || actual.Tags["b"] != 2 {
+		t.Fatalf("expected %+v, got %+v", expected, actual)
+	}
+
+	for _, value := range []any{struct{ C chan int }{}, []uint32{1}} {
+		if _, err := SerializeValue(value); err == nil {
+			t.Fatalf("expected an error rather than a panic for %T", value)
+		}
+	}
+}
+
+func TestTryReadTruncated(t *testing.T) {
+	setupStub(t)
+
+	serialized := MustSerializeData(testValue{A: 7, B: []byte{1, 2, 3}, C: "zkm"})
+	stubHints = append(stubHints, serialized[:len(serialized)-2], serialized[:len(serialized)-2])
+
+	if _, err := TryRead[testValue](); err == nil || !strings.Contains(err.Error(), "unexpected end of data") {
+		t.Fatalf("expected an unexpected end of data error, got: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected Read to panic on truncated data")
+		}
+	}()
+	Read[testValue]()
+}
+
+func TestTryReadTrailingBytes(t *testing.T) {
+	setupStub(t)
+
+	stubHints = append(stubHints, MustSerializeData(uint64(1)))
+	if _, err := TryRead[uint32](); err == nil || !strings.Contains(err.Error(), "4 unread bytes") {
+		t.Fatalf("expected an unread bytes error, got: %v", err)
+	}
+}
+
+func TestTryReadUnsupportedElem(t *testing.T) {
+	setupStub(t)
+
+	stubHints = append(stubHints, MustSerializeData([]byte{1, 0, 0, 0}))
+	var deserializeErr *DeserializeError
+	if _, err := TryRead[[]uint32](); !errors.As(err, &deserializeErr) || !strings.Contains(err.Error(), "unsupport type") {
+		t.Fatalf("expected an unsupported type DeserializeError, got: %v", err)
+	}
+}
+
+func TestTryDeserializeDataHugeLength(t *testing.T) {
+	data := MustSerializeData(uint64(1 << 63))
+	var value []byte
+	if err := TryDeserializeData(data, &value); err == nil {
+		t.Fatal("expected an error for a length prefix beyond the data")
+	}
+}
+
+func FuzzDeserializeHint(f *testing.F) {
+	seeds := [][]byte{
+		nil,
+		MustSerializeData(uint32(10)),
+		MustSerializeData(uint64(1 << 40)),
+		MustSerializeData(true),
+		MustSerializeData([]byte("hint")),
+		MustSerializeData("hint"),
+		MustSerializeData([32]byte{1}),
+		MustSerializeData(map[string]uint32{"a": 1}),
+		MustSerializeData(uint64(1 << 63)),
+	}
+	for typeID := 0; typeID < FuzzTypeCount; typeID++ {
+		for _, seed := range seeds {
+			f.Add(seed, typeID)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte, typeID int) {
+		FuzzDeserialize(data, typeID)
+	})
+}
+
+func TestFuzzDeserialize(t *testing.T) {
+	if err := FuzzDeserialize(MustSerializeData(uint32(10)), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := FuzzDeserialize([]byte{1}, 0); err == nil {
+		t.Fatal("expected an error for a truncated uint32")
+	}
+	if err := FuzzDeserialize(nil, FuzzTypeCount); err == nil {
+		t.Fatal("expected an error for an unknown type id")
+	}
+}
+
+func TestReadInto(t *testing.T) {
+	setupStub(t)
+
+	values := []testValue{
+		{A: 1, B: []byte{1}, C: "one"},
+		{A: 2, B: []byte{}, C: ""},
+		{A: 3, B: []byte{3, 3, 3}, C: "three"},
+	}
+	for _, value := range values {
+		stubHints = append(stubHints, MustSerializeData(value))
+	}
+
+	var actual testValue
+	for i, expected := range values {
+		ReadInto(&actual)
+		if actual.A != expected.A || !bytes.Equal(actual.B, expected.B) || actual.C != expected.C {
+			t.Fatalf("read %d: expected %+v, got %+v", i, expected, actual)
+		}
+	}
+}
+
+func TestReadVec(t *testing.T) {
+	setupStub(t)
+
+	expected := []testValue{
+		{A: 1, B: []byte{1}, C: "one"},
+		{A: 2, B: []byte{2, 2}, C: "two"},
+	}
+	stubHints = append(stubHints, MustSerializeData(uint32(len(expected))))
+	for _, value := range expected {
+		stubHints = append(stubHints, MustSerializeData(value))
+	}
+	stubHints = append(stubHints, MustSerializeData(uint32(0)))
+
+	actual := ReadVec[testValue]()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d values, got %d", len(expected), len(actual))
+	}
+	for i := range expected {
+		if actual[i].A != expected[i].A || !bytes.Equal(actual[i].B, expected[i].B) || actual[i].C != expected[i].C {
+			t.Fatalf("value %d: expected %+v, got %+v", i, expected[i], actual[i])
+		}
+	}
+
+	if empty := ReadVec[uint64](); len(empty) != 0 {
+		t.Fatalf("expected an empty slice, got %v", empty)
+	}
+	if len(stubHints) != 0 {
+		t.Fatalf("expected all hints to be consumed, %d left", len(stubHints))
+	}
+}
+
+func TestReadBytes(t *testing.T) {
+	setupStub(t)
+
+	blob := make([]byte, 10*1024)
+	for i := range blob {
+		blob[i] = byte(i * 31)
+	}
+	stubHints = append(stubHints, MustSerializeData(blob), MustSerializeData([]byte{}))
+
+	if actual := ReadBytes(); !bytes.Equal(actual, blob) {
+		t.Fatal("expected ReadBytes to return the blob verbatim")
+	}
+	if empty := ReadBytes(); len(empty) != 0 {
+		t.Fatalf("expected an empty blob, got %x", empty)
+	}
+
+	stubHints = append(stubHints, MustSerializeData(blob)[:100])
+	defer func() {
+		if _, ok := recover().(*DeserializeError); !ok {
+			t.Fatal("expected a DeserializeError for a truncated blob")
+		}
+	}()
+	ReadBytes()
+}
+
+// taggedHint frames payload as a ReadTagged message.
+func taggedHint(tag byte, payload []byte) []byte {
+	return append([]byte{tag}, MustSerializeData(payload)...)
+}
+
+func TestReadTagged(t *testing.T) {
+	setupStub(t)
+
+	stubHints = append(stubHints, taggedHint(1, []byte("first")), taggedHint(2, nil))
+
+	tag, payload := ReadTagged()
+	if tag != 1 || string(payload) != "first" {
+		t.Fatalf("unexpected first message: %d %q", tag, payload)
+	}
+	tag, payload = ReadTagged()
+	if tag != 2 || len(payload) != 0 {
+		t.Fatalf("unexpected second message: %d %q", tag, payload)
+	}
+}
+
+func TestReadTaggedLengthMismatch(t *testing.T) {
+	setupStub(t)
+
+	hint := taggedHint(1, []byte("first"))
+	stubHints = append(stubHints, hint[:len(hint)-1])
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a panic for a truncated payload")
+		}
+	}()
+	ReadTagged()
+}
+
+func TestReadOutOfMemory(t *testing.T) {
+	setupStub(t)
+
+	RESERVED_INPUT_PTR = MAX_MEMORY - 8
+	stubHints = append(stubHints, MustSerializeData(uint32(1)), MustSerializeData(uint64(2)))
+
+	if code := exitCode(t, func() { Read[uint32]() }); code != -1 {
+		t.Fatalf("expected the first read to fit, got exit code %d", code)
+	}
+	if code := exitCode(t, func() { Read[uint64]() }); code != READ_OOM_EXIT_CODE {
+		t.Fatalf("expected exit code %#x, got %#x", READ_OOM_EXIT_CODE, code)
+	}
+	if RESERVED_INPUT_PTR != MAX_MEMORY {
+		t.Fatalf("expected the reserved input pointer to stay at %#x, got %#x", MAX_MEMORY, RESERVED_INPUT_PTR)
+	}
+}
+
+func TestReservedInputUsage(t *testing.T) {
+	setupStub(t)
+
+	if used, total := ReservedInputUsage(); used != 0 || total != EMBEDDED_RESERVED_INPUT_REGION_SIZE {
+		t.Fatalf("expected 0 of %d bytes used, got %d of %d", EMBEDDED_RESERVED_INPUT_REGION_SIZE, used, total)
+	}
+
+	hints := [][]byte{MustSerializeData(uint32(1)), MustSerializeData(uint64(2)), MustSerializeData([]byte{1, 2, 3})}
+	stubHints = append(stubHints, hints...)
+	read := []func(){
+		func() { Read[uint32]() },
+		func() { Read[uint64]() },
+		func() { Read[[]byte]() },
+	}
+	expected := 0
+	for i, hint := range hints {
+		read[i]()
+		expected += (len(hint) + 7) / 8 * 8
+		if used, _ := ReservedInputUsage(); used != expected {
+			t.Fatalf("read %d: expected %d bytes used, got %d", i, expected, used)
+		}
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	setupStub(t)
+	maxMemory, regionSize := MAX_MEMORY, EMBEDDED_RESERVED_INPUT_REGION_SIZE
+	t.Cleanup(func() {
+		MAX_MEMORY, EMBEDDED_RESERVED_INPUT_REGION_SIZE = maxMemory, regionSize
+		RESERVED_INPUT_PTR = MAX_MEMORY - EMBEDDED_RESERVED_INPUT_REGION_SIZE
+	})
+
+	Configure(MemoryConfig{MaxMemory: 0x1000, ReservedInputRegionSize: 16})
+	if used, total := ReservedInputUsage(); used != 0 || total != 16 {
+		t.Fatalf("expected 0 of 16 bytes used, got %d of %d", used, total)
+	}
+	for i := 0; i < 3; i++ {
+		stubHints = append(stubHints, MustSerializeData(uint64(i)))
+	}
+	for i := 0; i < 2; i++ {
+		if code := exitCode(t, func() { Read[uint64]() }); code != -1 {
+			t.Fatalf("read %d: expected to fit, got exit code %#x", i, code)
+		}
+	}
+	if code := exitCode(t, func() { Read[uint64]() }); code != READ_OOM_EXIT_CODE {
+		t.Fatalf("expected exit code %#x, got %#x", READ_OOM_EXIT_CODE, code)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected Configure to panic after hints were read")
+		}
+	}()
+	Configure(MemoryConfig{MaxMemory: 0x2000, ReservedInputRegionSize: 16})
+}
+
+func TestReadAlignment(t *testing.T) {
+	setupStub(t)
+
+	type wide struct {
+		Flag  bool
+		Value int64
+		Count uint64
+	}
+	// An unaligned pointer is realigned before the first read.
+	RESERVED_INPUT_PTR += 3
+	values := []wide{{true, -1, 1}, {false, 1 << 40, 2}, {true, -(1 << 62), 3}}
+	for _, value := range values {
+		stubHints = append(stubHints, MustSerializeData(value))
+	}
+
+	for i, expected := range values {
+		if actual := Read[wide](); actual != expected {
+			t.Fatalf("read %d: expected %+v, got %+v", i, expected, actual)
+		}
+		if RESERVED_INPUT_PTR%8 != 0 {
+			t.Fatalf("read %d: reserved input pointer %#x is not 8 byte aligned", i, RESERVED_INPUT_PTR)
+		}
+	}
+}
+
+func TestReadHintTooLarge(t *testing.T) {
+	setupStub(t)
+	defer func(max int) { MaxHintLen = max }(MaxHintLen)
+
+	MaxHintLen = 8
+	stubHints = append(stubHints, MustSerializeData(uint64(1)), MustSerializeData([]byte{2, 3}))
+	if code := exitCode(t, func() { Read[uint64]() }); code != -1 {
+		t.Fatalf("expected a hint of MaxHintLen bytes to be read, got exit code %#x", code)
+	}
+	used, _ := ReservedInputUsage()
+	if code := exitCode(t, func() { Read[[]byte]() }); code != HINT_TOO_LARGE_EXIT_CODE {
+		t.Fatalf("expected exit code %#x, got %#x", HINT_TOO_LARGE_EXIT_CODE, code)
+	}
+	if after, _ := ReservedInputUsage(); after != used {
+		t.Fatalf("expected the oversized hint to reserve nothing, usage went from %d to %d", used, after)
+	}
+}
+
+func TestReadHintLengthBounds(t *testing.T) {
+	setupStub(t)
+	defer func(max, size, ptr int) {
+		MAX_MEMORY, EMBEDDED_RESERVED_INPUT_REGION_SIZE, RESERVED_INPUT_PTR = max, size, ptr
+	}(MAX_MEMORY, EMBEDDED_RESERVED_INPUT_REGION_SIZE, RESERVED_INPUT_PTR)
+
+	stubHintLen = func() int { return -1 }
+	if code := exitCode(t, func() { readHint() }); code != HINT_TOO_LARGE_EXIT_CODE {
+		t.Fatalf("expected exit code %#x for a negative length, got %#x", HINT_TOO_LARGE_EXIT_CODE, code)
+	}
+
+	// With the region at the top of int, addr+capacity would wrap as it does on 32-bit mipsle.
+	MAX_MEMORY = math.MaxInt &^ (readHintAlign - 1)
+	EMBEDDED_RESERVED_INPUT_REGION_SIZE = 1 << 30
+	RESERVED_INPUT_PTR = MAX_MEMORY - 16
+	for _, length := range []int{17, 1 << 28} {
+		stubHintLen = func() int { return length }
+		if code := exitCode(t, func() { readHint() }); code != READ_OOM_EXIT_CODE {
+			t.Fatalf("expected exit code %#x for a %d byte hint, got %#x", READ_OOM_EXIT_CODE, length, code)
+		}
+		if RESERVED_INPUT_PTR != MAX_MEMORY-16 {
+			t.Fatalf("expected the %d byte hint to reserve nothing", length)
+		}
+	}
+}
+
+func TestMaxHintLenDefault(t *testing.T) {
+	setupStub(t)
+
+	if MaxHintLen != 0 || maxHintLen() != EMBEDDED_RESERVED_INPUT_REGION_SIZE {
+		t.Fatalf("expected the default hint limit to be the reserved input region, got %d", maxHintLen())
+	}
+	stubHintLen = func() int { return EMBEDDED_RESERVED_INPUT_REGION_SIZE + 1 }
+	if code := exitCode(t, func() { readHint() }); code != HINT_TOO_LARGE_EXIT_CODE {
+		t.Fatalf("expected exit code %#x, got %#x", HINT_TOO_LARGE_EXIT_CODE, code)
+	}
+}
+
+func TestComputePublicValuesDigest(t *testing.T) {
+	setupStub(t)
+
+	value := testValue{A: 1, B: []byte{2, 3}, C: "four"}
+	Commit(value)
+	CommitBytes([]byte{5})
+	Commit(uint64(6))
+	exitCode(t, func() { RuntimeExit(0) })
+
+	expected := ComputePublicValuesDigest([][]byte{
+		MustSerializeData(value),
+		{5},
+		MustSerializeData(uint64(6)),
+	})
+	for i, word := range expected {
+		if stubCommits[i] != word {
+			t.Fatalf("word %d: guest committed %#x, host computed %#x", i, stubCommits[i], word)
+		}
+	}
+}
+
+func TestCommitTo(t *testing.T) {
+	setupStub(t)
+
+	const auxFd = 14
+	Commit(uint32(1))
+	CommitTo(auxFd, "aux")
+	CommitTo(13, uint16(2))
+
+	expected := append(MustSerializeData(uint32(1)), MustSerializeData(uint16(2))...)
+	if !bytes.Equal(stubWrites[13], expected) {
+		t.Fatalf("expected public values %x, got %x", expected, stubWrites[13])
+	}
+	if aux := MustSerializeData("aux"); !bytes.Equal(stubWrites[auxFd], aux) {
+		t.Fatalf("expected aux values %x, got %x", aux, stubWrites[auxFd])
+	}
+
+	// The digest covers all three commits in call order.
+	digest := ComputePublicValuesDigest([][]byte{
+		MustSerializeData(uint32(1)),
+		MustSerializeData("aux"),
+		MustSerializeData(uint16(2)),
+	})
+	exitCode(t, func() { RuntimeExit(0) })
+	for i, word := range digest {
+		if stubCommits[i] != word {
+			t.Fatalf("word %d: committed %#x, expected %#x", i, stubCommits[i], word)
+		}
+	}
+}
+
+func TestCommitFixedWidth(t *testing.T) {
+	setupStub(t)
+
+	CommitU64(0x0102030405060708)
+	expected := []byte{8, 7, 6, 5, 4, 3, 2, 1}
+	if !bytes.Equal(stubWrites[13], expected) {
+		t.Fatalf("expected %x, got %x", expected, stubWrites[13])
+	}
+	digest := sha256.Sum256(expected)
+	if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, digest[:]) {
+		t.Fatalf("expected digest %x, got %x", digest, actual)
+	}
+
+	// Each matches Commit of the same typed value.
+	for _, commit := range []struct {
+		fixed, generic func()
+	}{
+		{func() { CommitU32(7) }, func() { Commit(uint32(7)) }},
+		{func() { CommitI32(-7) }, func() { Commit(int32(-7)) }},
+		{func() { CommitI64(-7) }, func() { Commit(int64(-7)) }},
+	} {
+		setupStub(t)
+		commit.generic()
+		expected := stubWrites[13]
+		setupStub(t)
+		commit.fixed()
+		if !bytes.Equal(stubWrites[13], expected) {
+			t.Fatalf("expected %x, got %x", expected, stubWrites[13])
+		}
+	}
+
+	if _, err := SerializeData(1); err == nil {
+		t.Fatal("expected int to be rejected as platform dependent")
+	}
+}
+
+func TestCommitAll(t *testing.T) {
+	a := testValue{A: 1, B: []byte{2, 3}, C: "four"}
+	b := uint16(5)
+	c := [3]byte{6, 7, 8}
+
+	setupStub(t)
+	Commit(a)
+	Commit(b)
+	Commit(c)
+	expectedDigest := PublicValuesHasher.Sum(nil)
+	expectedStream := stubWrites[13]
+
+	setupStub(t)
+	CommitAll(a, b, c)
+	if digest := PublicValuesHasher.Sum(nil); !bytes.Equal(digest, expectedDigest) {
+		t.Fatalf("expected digest %x, got %x", expectedDigest, digest)
+	}
+	if !bytes.Equal(stubWrites[13], expectedStream) {
+		t.Fatalf("expected public values %x, got %x", expectedStream, stubWrites[13])
+	}
+}
+
+func TestCommitRLE(t *testing.T) {
+	setupStub(t)
+
+	values := []uint32{7, 7, 7, 7, 1, 2, 2, 7, 7, 7}
+	CommitRLE(values)
+
+	// Four runs of (u64 length, u32 value).
+	var expected []byte
+	expected = binary.LittleEndian.AppendUint64(expected, 4)
+	for _, run := range [][2]uint32{{4, 7}, {1, 1}, {2, 2}, {3, 7}} {
+		expected = binary.LittleEndian.AppendUint64(expected, uint64(run[0]))
+		expected = binary.LittleEndian.AppendUint32(expected, run[1])
+	}
+	if !bytes.Equal(stubWrites[13], expected) {
+		t.Fatalf("expected committed runs %x, got %x", expected, stubWrites[13])
+	}
+	digest := sha256.Sum256(expected)
+	if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, digest[:]) {
+		t.Fatalf("expected digest %x, got %x", digest, actual)
+	}
+
+	decoded, err := DecodeRLE[uint32](stubWrites[13])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(decoded, values) {
+		t.Fatalf("expected %v, got %v", values, decoded)
+	}
+
+	setupStub(t)
+	CommitRLE([]string{})
+	if decoded, err := DecodeRLE[string](stubWrites[13]); err != nil || len(decoded) != 0 {
+		t.Fatalf("expected no values, got %q, %v", decoded, err)
+	}
+	if _, err := DecodeRLE[uint32](expected[:len(expected)-1]); err == nil {
+		t.Fatal("expected an error for truncated runs")
+	}
+}
+
+func TestDecodeRLELimit(t *testing.T) {
+	// 17 bytes claiming a single run of about 2^31 bytes.
+	var hostile []byte
+	hostile = binary.LittleEndian.AppendUint64(hostile, 1)
+	hostile = binary.LittleEndian.AppendUint64(hostile, math.MaxInt32-1)
+	hostile = append(hostile, 0xff)
+	if _, err := DecodeRLE[uint8](hostile); err == nil || !strings.Contains(err.Error(), "MaxRLELen") {
+		t.Fatalf("expected the run to exceed MaxRLELen, got: %v", err)
+	}
+
+	defer func(max int) { MaxRLELen = max }(MaxRLELen)
+	MaxRLELen = 10
+	setupStub(t)
+	values := []uint32{7, 7, 7, 7, 1, 2, 2, 7, 7, 7}
+	CommitRLE(values)
+	if decoded, err := DecodeRLE[uint32](stubWrites[13]); err != nil || !slices.Equal(decoded, values) {
+		t.Fatalf("expected %v within the limit, got %v, %v", values, decoded, err)
+	}
+	MaxRLELen = 9
+	if _, err := DecodeRLE[uint32](stubWrites[13]); err == nil {
+		t.Fatal("expected an error for runs expanding past MaxRLELen")
+	}
+}
+
+func TestCommitFramed(t *testing.T) {
+	setupStub(t)
+
+	first := []byte("variable length output")
+	second := []byte{1, 2, 3}
+	CommitFramed(first)
+	CommitFramed(second)
+	CommitFramed(nil)
+
+	payloads, err := ReadFramedCommits(bytes.NewReader(stubWrites[13]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 3 || !bytes.Equal(payloads[0], first) || !bytes.Equal(payloads[1], second) || len(payloads[2]) != 0 {
+		t.Fatalf("expected [%x %x []], got %x", first, second, payloads)
+	}
+
+	// The stream is hashed as written.
+	expected := sha256.Sum256(stubWrites[13])
+	if digest := PublicValuesHasher.Sum(nil); !bytes.Equal(digest, expected[:]) {
+		t.Fatalf("expected digest %x, got %x", expected, digest)
+	}
+
+	if _, err := ReadFramedCommits(bytes.NewReader(stubWrites[13][:len(stubWrites[13])-6])); err == nil {
+		t.Fatal("expected an error for a truncated stream")
+	}
+}
+
+func TestAssert(t *testing.T) {
+	setupStub(t)
+
+	if code := exitCode(t, func() { Assert(true, 3, "unreachable") }); code != -1 {
+		t.Fatalf("expected a passing Assert to return, got exit code %d", code)
+	}
+	if len(stubWrites[13]) != 0 {
+		t.Fatalf("expected nothing committed by a passing Assert, got %q", stubWrites[13])
+	}
+
+	reason := "balance underflow"
+	if code := exitCode(t, func() { Assert(false, 3, reason) }); code != 3 {
+		t.Fatalf("expected exit code 3, got %d", code)
+	}
+	if string(stubWrites[13]) != reason {
+		t.Fatalf("expected the reason %q to be committed, got %q", reason, stubWrites[13])
+	}
+	expected := ComputePublicValuesDigest([][]byte{[]byte(reason)})
+	for i, word := range expected {
+		if stubCommits[i] != word {
+			t.Fatalf("word %d: committed %#x, expected %#x", i, stubCommits[i], word)
+		}
+	}
+}
+
+func TestReplayHints(t *testing.T) {
+	setupStub(t)
+
+	// A guest that commits the sum of its two inputs.
+	guest := func() {
+		a := Read[uint32]()
+		b := Read[uint32]()
+		Commit(a + b)
+		RuntimeExit(0)
+	}
+	tests := []struct{ a, b, sum uint32 }{{1, 2, 3}, {0, 0, 0}, {1 << 31, 1 << 31, 0}}
+	for _, test := range tests {
+		result := ReplayHints([][]byte{MustSerializeData(test.a), MustSerializeData(test.b)}, guest)
+		if result.ExitCode != 0 {
+			t.Fatalf("%d + %d: expected exit code 0, got %d", test.a, test.b, result.ExitCode)
+		}
+		if expected := MustSerializeData(test.sum); !bytes.Equal(result.PublicValues, expected) {
+			t.Fatalf("%d + %d: expected public values %x, got %x", test.a, test.b, expected, result.PublicValues)
+		}
+		digest := ComputePublicValuesDigest([][]byte{MustSerializeData(test.sum)})
+		for i, word := range digest {
+			if result.Commits[i] != word {
+				t.Fatalf("%d + %d: word %d: committed %#x, expected %#x", test.a, test.b, i, result.Commits[i], word)
+			}
+		}
+	}
+
+	if result := ReplayHints(nil, func() { Commit(uint8(1)) }); result.ExitCode != -1 || len(result.PublicValues) != 1 {
+		t.Fatalf("expected a guest returning normally, got %+v", result)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected int
+		trap     func()
+	}{
+		{"read out of memory", READ_OOM_EXIT_CODE, func() {
+			RESERVED_INPUT_PTR = MAX_MEMORY
+			stubHints = append(stubHints, MustSerializeData(uint32(1)))
+			Read[uint32]()
+		}},
+		{"invalid digest", INVALID_DIGEST_EXIT_CODE, func() {
+			PublicValuesHasher = unalignedHasher{sha256.New()}
+			RuntimeExit(0)
+		}},
+		{"deserialize", DESERIALIZE_EXIT_CODE, func() {
+			stubHints = append(stubHints, []byte{1})
+			Guard(func() { Read[uint32]() })
+		}},
+		{"deserialize tagged", DESERIALIZE_EXIT_CODE, func() {
+			stubHints = append(stubHints, []byte{1})
+			Guard(func() { ReadTagged() })
+		}},
+		{"hint too large", HINT_TOO_LARGE_EXIT_CODE, func() {
+			defer func(max int) { MaxHintLen = max }(MaxHintLen)
+			MaxHintLen = 7
+			stubHints = append(stubHints, MustSerializeData(uint64(1)))
+			Read[uint64]()
+		}},
+		{"panic", PANIC_EXIT_CODE, func() {
+			Guard(func() { panic("boom") })
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setupStub(t)
+			if code := exitCode(t, test.trap); code != test.expected {
+				t.Fatalf("expected exit code %#x, got %#x", test.expected, code)
+			}
+		})
+	}
+}
+
+func TestCommitAndExit(t *testing.T) {
+	setupStub(t)
+
+	value := testValue{A: 7, B: []byte{1, 2, 3}, C: "zkm"}
+	Commit(value)
+
+	serialized := MustSerializeData(value)
+	if !bytes.Equal(stubWrites[13], serialized) {
+		t.Fatalf("unexpected commit stream: %x", stubWrites[13])
+	}
+
+	padded := append(serialized, make([]byte, (4-len(serialized)%4)%4)...)
+	digest := sha256.Sum256(padded)
+
+	if code := exitCode(t, func() { RuntimeExit(0) }); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if len(stubCommits) != 8 {
+		t.Fatalf("expected 8 committed words, got %d", len(stubCommits))
+	}
+	for i := 0; i < 8; i++ {
+		if expected := binary.LittleEndian.Uint32(digest[i*4:]); stubCommits[i] != expected {
+			t.Fatalf("word %d: expected %08x, got %08x", i, expected, stubCommits[i])
+		}
+	}
+}
+
+func TestPadToWord(t *testing.T) {
+	for _, length := range []int{0, 1, 3, 4, 5} {
+		b := bytes.Repeat([]byte{0xff}, length)
+		padded := padToWord(b)
+		expectedLen := (length + 3) / 4 * 4
+		if len(padded) != expectedLen {
+			t.Fatalf("length %d: expected %d padded bytes, got %d", length, expectedLen, len(padded))
+		}
+		if !bytes.Equal(padded[:length], b) || !bytes.Equal(padded[length:], make([]byte, expectedLen-length)) {
+			t.Fatalf("length %d: unexpected padding %x", length, padded)
+		}
+		if length%4 == 0 && length > 0 && &padded[0] != &b[0] {
+			t.Fatalf("length %d: aligned input was copied", length)
+		}
+		if length%4 != 0 && &padded[0] == &b[0] {
+			t.Fatalf("length %d: unaligned input was padded in place", length)
+		}
+	}
+}
+
+func TestCommitBytes(t *testing.T) {
+	setupStub(t)
+
+	Commit([5]byte{1, 2, 3, 4, 5})
+	commitDigest := PublicValuesHasher.Sum(nil)
+	commitStream := stubWrites[13]
+
+	setupStub(t)
+	raw := []byte{1, 2, 3, 4, 5}
+	CommitBytes(raw)
+	if !bytes.Equal(stubWrites[13], commitStream) {
+		t.Fatalf("expected commit stream %x, got %x", commitStream, stubWrites[13])
+	}
+	if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, commitDigest) {
+		t.Fatalf("expected digest %x, got %x", commitDigest, actual)
+	}
+	if !bytes.Equal(raw, []byte{1, 2, 3, 4, 5}) {
+		t.Fatalf("CommitBytes modified its input: %x", raw)
+	}
+}
+
+func TestCommitArray32(t *testing.T) {
+	v := sha256.Sum256([]byte("zkm"))
+
+	setupStub(t)
+	Commit(v)
+	commitDigest := PublicValuesHasher.Sum(nil)
+	commitStream := stubWrites[13]
+
+	setupStub(t)
+	CommitArray32(v)
+	if !bytes.Equal(stubWrites[13], commitStream) {
+		t.Fatalf("expected commit stream %x, got %x", commitStream, stubWrites[13])
+	}
+	if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, commitDigest) {
+		t.Fatalf("expected digest %x, got %x", commitDigest, actual)
+	}
+}
+
+func BenchmarkCommitArray32(b *testing.B) {
+	v := sha256.Sum256([]byte("zkm"))
+	b.Run("Commit", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			resetStub()
+			Commit(v)
+		}
+	})
+	b.Run("CommitArray32", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			resetStub()
+			CommitArray32(v)
+		}
+	})
+}
+
+func TestCommitAndBytes(t *testing.T) {
+	value := testValue{A: 3, B: []byte{1, 2, 3}, C: "abc"}
+
+	setupStub(t)
+	Commit(value)
+	commitDigest := PublicValuesHasher.Sum(nil)
+	commitStream := stubWrites[13]
+
+	setupStub(t)
+	b := CommitAndBytes(value)
+	serialized := MustSerializeData(value)
+	expected := make([]byte, (len(serialized)+3)/4*4)
+	copy(expected, serialized)
+	if !bytes.Equal(b, expected) {
+		t.Fatalf("expected %x, got %x", expected, b)
+	}
+	if !bytes.Equal(stubWrites[13], commitStream) {
+		t.Fatalf("expected commit stream %x, got %x", commitStream, stubWrites[13])
+	}
+	if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, commitDigest) {
+		t.Fatalf("expected digest %x, got %x", commitDigest, actual)
+	}
+
+	other := CommitAndBytes(value)
+	other[0] ^= 0xff
+	if !bytes.Equal(b, expected) {
+		t.Fatal("CommitAndBytes returned a shared buffer")
+	}
+}
+
+func TestSerializeDataSkipsUnexported(t *testing.T) {
+	type mixed struct {
+		A      uint8
+		hidden uint32
+		B      uint16
+		cache  []byte
+		C      string
+	}
+	value := mixed{A: 1, hidden: 0xdeadbeef, B: 2, cache: []byte{9, 9}, C: "c"}
+	serialized, err := SerializeData(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{1, 2, 0, 1, 0, 0, 0, 0, 0, 0, 0, 'c'}
+	if !bytes.Equal(serialized, expected) {
+		t.Fatalf("expected %x, got %x", expected, serialized)
+	}
+
+	var decoded mixed
+	DeserializeData(serialized, &decoded)
+	if decoded.A != 1 || decoded.B != 2 || decoded.C != "c" || decoded.hidden != 0 || decoded.cache != nil {
+		t.Fatalf("unexpected round trip: %+v", decoded)
+	}
+
+	if _, err := SerializeData(struct{ F float64 }{1}); err == nil {
+		t.Fatal("expected an error for an unsupported field type")
+	}
+}
+
+func TestSerializeDataUnsupportedElem(t *testing.T) {
+	for _, value := range []any{[]uint32{1}, [2]uint32{}, struct{ F []int16 }{}} {
+		if _, err := SerializeData(value); err == nil || !strings.Contains(err.Error(), "unsupport type") {
+			t.Fatalf("expected an unsupported type error for %T, got: %v", value, err)
+		}
+	}
+}
+
+func TestCommitMapSortedKeys(t *testing.T) {
+	keys := make([]string, 64)
+	for i := range keys {
+		keys[i] = string(rune('a'+i%26)) + strings.Repeat("x", i/26)
+	}
+
+	var digests [][]byte
+	for run := 0; run < 8; run++ {
+		// Insert in a different order each run.
+		m := map[string]uint32{}
+		for i := range keys {
+			key := keys[(i*(2*run+1))%len(keys)]
+			m[key] = uint32(len(key))
+		}
+
+		setupStub(t)
+		Commit(m)
+		CommitStream(m)
+		digests = append(digests, PublicValuesHasher.Sum(nil))
+	}
+	for i := 1; i < len(digests); i++ {
+		if !bytes.Equal(digests[i], digests[0]) {
+			t.Fatalf("run %d: expected digest %x, got %x", i, digests[0], digests[i])
+		}
+	}
+
+	// Entries follow the length prefix in ascending key order.
+	serialized := MustSerializeData(map[int16]byte{3: 30, -1: 10, 2: 20})
+	expected := []byte{3, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 10, 2, 0, 20, 3, 0, 30}
+	if !bytes.Equal(serialized, expected) {
+		t.Fatalf("expected %x, got %x", expected, serialized)
+	}
+	var decoded map[int16]byte
+	DeserializeData(serialized, &decoded)
+	if len(decoded) != 3 || decoded[-1] != 10 || decoded[2] != 20 || decoded[3] != 30 {
+		t.Fatalf("unexpected round trip: %v", decoded)
+	}
+
+	if _, err := SerializeData(map[[2]byte]byte{{1, 2}: 3}); err == nil {
+		t.Fatal("expected an error for an unordered map key type")
+	}
+}
+
+func TestCommitStream(t *testing.T) {
+	large := testValue{A: 9, B: bytes.Repeat([]byte{0x5a}, 3*commitStreamChunkSize+5), C: "large"}
+
+	setupStub(t)
+	Commit(large)
+	Commit(uint16(1))
+	commitDigest := PublicValuesHasher.Sum(nil)
+	commitStream := stubWrites[13]
+
+	setupStub(t)
+	CommitStream(large)
+	CommitStream(uint16(1))
+	if !bytes.Equal(stubWrites[13], commitStream) {
+		t.Fatal("CommitStream wrote a different commit stream than Commit")
+	}
+	if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, commitDigest) {
+		t.Fatalf("expected digest %x, got %x", commitDigest, actual)
+	}
+}
+
+func TestConcurrentCommit(t *testing.T) {
+	const nbCommits = 64
+	value := testValue{A: 7, B: bytes.Repeat([]byte{1}, 1000), C: "zkm"}
+
+	setupStub(t)
+	for i := 0; i < nbCommits; i++ {
+		Commit(value)
+	}
+	expected := PublicValuesHasher.Sum(nil)
+
+	for run := 0; run < 4; run++ {
+		setupStub(t)
+		var wg sync.WaitGroup
+		for i := 0; i < nbCommits; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if i%2 == 0 {
+					Commit(value)
+				} else {
+					CommitStream(value)
+				}
+			}()
+		}
+		wg.Wait()
+		if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, expected) {
+			t.Fatalf("run %d: expected digest %x, got %x", run, expected, actual)
+		}
+	}
+}
+
+func TestLog(t *testing.T) {
+	setupStub(t)
+	defer func() { DebugLogging = false }()
+
+	Log("dropped\n")
+	if len(stubWrites[2]) != 0 {
+		t.Fatalf("expected no output with DebugLogging off, got %q", stubWrites[2])
+	}
+
+	DebugLogging = true
+	Commit(uint32(1))
+	Log("hello\n")
+	Commit(uint32(2))
+
+	if string(stubWrites[2]) != "hello\n" {
+		t.Fatalf("unexpected log output: %q", stubWrites[2])
+	}
+	expected := append(MustSerializeData(uint32(1)), MustSerializeData(uint32(2))...)
+	if !bytes.Equal(stubWrites[13], expected) {
+		t.Fatalf("log output leaked into the commit stream: %x", stubWrites[13])
+	}
+	digest := sha256.Sum256(expected)
+	if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, digest[:]) {
+		t.Fatalf("log output changed the public values digest")
+	}
+}
+
+func TestGuard(t *testing.T) {
+	setupStub(t)
+	DebugLogging = true
+	defer func() { DebugLogging = false }()
+
+	code := exitCode(t, func() {
+		Guard(func() { panic("bad input") })
+	})
+	if code != PANIC_EXIT_CODE {
+		t.Fatalf("expected exit code %d, got %d", PANIC_EXIT_CODE, code)
+	}
+	if string(stubWrites[2]) != "panic: bad input\n" {
+		t.Fatalf("unexpected log output: %q", stubWrites[2])
+	}
+
+	// An exit from within the guarded function keeps its own code.
+	code = exitCode(t, func() {
+		Guard(func() { RuntimeExit(3) })
+	})
+	if code != 3 {
+		t.Fatalf("expected exit code 3, got %d", code)
+	}
+
+	if code := exitCode(t, func() { Guard(func() {}) }); code != -1 {
+		t.Fatalf("expected no exit, got %d", code)
+	}
+}
+
+func TestResetPublicValues(t *testing.T) {
+	setupStub(t)
+
+	Commit(uint32(1))
+	stubHints = append(stubHints, MustSerializeData(uint32(2)))
+	Read[uint32]()
+	ResetPublicValues()
+
+	if RESERVED_INPUT_PTR != MAX_MEMORY-EMBEDDED_RESERVED_INPUT_REGION_SIZE {
+		t.Fatalf("expected the reserved input pointer to be rewound, got %#x", RESERVED_INPUT_PTR)
+	}
+
+	Commit(uint32(3))
+	expected := sha256.Sum256(MustSerializeData(uint32(3)))
+	if actual := PublicValuesHasher.Sum(nil); !bytes.Equal(actual, expected[:]) {
+		t.Fatalf("expected digest %x, got %x", expected, actual)
+	}
+}
+
+func TestKeccak256PublicValuesHasher(t *testing.T) {
+	setupStub(t)
+
+	SetPublicValuesHasher(NewKeccak256Hasher())
+	Commit([3]byte{'a', 'b', 'c'})
+	Commit(uint32(7))
+
+	// Keccak256 of the word-padded commits, "abc\x00" || 07000000.
+	digest, _ := hex.DecodeString("f704ad5a1081d04e35105d779d9f4d838dbbbc150026f709b94f888a3c5de98d")
+	if code := exitCode(t, func() { RuntimeExit(0) }); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	for i := 0; i < 8; i++ {
+		if expected := binary.LittleEndian.Uint32(digest[i*4:]); stubCommits[i] != expected {
+			t.Fatalf("word %d: expected %08x, got %08x", i, expected, stubCommits[i])
+		}
+	}
+}
+
+func TestRuntimeExitLongDigest(t *testing.T) {
+	setupStub(t)
+
+	// The executor only holds PV_DIGEST_NUM_WORDS words, so a longer digest must not be committed.
+	PublicValuesHasher = sha512.New()
+	Commit(uint32(7))
+	if code := exitCode(t, func() { RuntimeExit(0) }); code != INVALID_DIGEST_EXIT_CODE {
+		t.Fatalf("expected exit code %#x, got %#x", INVALID_DIGEST_EXIT_CODE, code)
+	}
+	if len(stubCommitOrder) != 0 {
+		t.Fatalf("expected no committed words, got %d", len(stubCommitOrder))
+	}
+}
+
+// unalignedHasher produces a 33 byte digest, bypassing the SetPublicValuesHasher check.
+type unalignedHasher struct {
+	hash.Hash
+}
+
+func (h unalignedHasher) Sum(b []byte) []byte {
+	return append(h.Hash.Sum(b), 0)
+}
+
+func TestRuntimeExitUnalignedDigest(t *testing.T) {
+	setupStub(t)
+
+	PublicValuesHasher = unalignedHasher{sha256.New()}
+	if code := exitCode(t, func() { RuntimeExit(0) }); code != INVALID_DIGEST_EXIT_CODE {
+		t.Fatalf("expected exit code %#x, got %#x", INVALID_DIGEST_EXIT_CODE, code)
+	}
+	if len(stubCommitOrder) != 0 {
+		t.Fatalf("expected no committed words, got %d", len(stubCommitOrder))
+	}
+}
+
+func TestSetPublicValuesHasherInvalidSize(t *testing.T) {
+	for _, h := range []hash.Hash{sha256.New224(), sha512.New()} {
+		setupStub(t)
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic for a %d byte hasher", h.Size())
+				}
+			}()
+			SetPublicValuesHasher(h)
+		}()
+		if PublicValuesHasher == h {
+			t.Fatalf("expected the %d byte hasher not to be installed", h.Size())
+		}
+	}
+}
+
+func TestKeccak256(t *testing.T) {
+	setupStub(t)
+
+	// Includes the 135-byte padding edge case and inputs spanning several rate blocks.
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{nil, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{[]byte("abc"), "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+		{bytes.Repeat([]byte{0xab}, 135), "932fedc0e854cc4d32eec69e896c7449570052b3aaceacff7b13745325e4cf47"},
+		{bytes.Repeat([]byte{0xab}, 136), "302db73a4c8cc8ecc9004fec3a6525d9d6a2dd4b098b1bf62d1b897acff18c9d"},
+		{bytes.Repeat([]byte{0xab}, 300), "315f259936b44c2fd956d917deacbaa548f17a9d26d17df4fa2bdec09966e007"},
+	}
+	for _, test := range tests {
+		digest := Keccak256(test.input)
+		if actual := hex.EncodeToString(digest[:]); actual != test.expected {
+			t.Fatalf("Keccak256 of %d bytes: expected %s, got %s", len(test.input), test.expected, actual)
+		}
+	}
+}
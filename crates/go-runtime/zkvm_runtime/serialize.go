@@ -3,17 +3,25 @@
 package zkvm_runtime
 
 import (
+	"bytes"
+	"cmp"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"reflect"
+	"slices"
 )
 
+// SerializeData encodes data in the bincode layout read by DeserializeData. Struct fields are
+// written in declaration order; unexported fields are skipped. An unsupported type is reported
+// as an error, where MustSerializeData panics.
 func SerializeData(data any) ([]byte, error) {
 	return serializeData(reflect.ValueOf(data))
 }
 
+// MustSerializeData is SerializeData panicking on an unsupported type.
 func MustSerializeData(data interface{}) []byte {
-	serializedData, err := serializeData(reflect.ValueOf(data))
+	serializedData, err := SerializeData(data)
 	if err != nil {
 		panic(err)
 	}
@@ -21,94 +29,155 @@ func MustSerializeData(data interface{}) []byte {
 }
 
 func serializeData(v reflect.Value) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := serializeTo(&buf, v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// serializeTo writes the serialization of v to w as it walks v, without materializing it.
+func serializeTo(w io.Writer, v reflect.Value) error {
+	var b [8]byte
+	var err error
 	switch v.Kind() {
 	case reflect.Bool:
 		if v.Bool() {
-			return []byte{1}, nil
+			b[0] = 1
 		}
-		return []byte{0}, nil
+		_, err = w.Write(b[:1])
+		return err
 	case reflect.Int8:
-		return []byte{uint8(v.Int())}, nil
+		b[0] = uint8(v.Int())
+		_, err = w.Write(b[:1])
+		return err
 	case reflect.Uint8:
-		return []byte{uint8(v.Uint())}, nil
+		b[0] = uint8(v.Uint())
+		_, err = w.Write(b[:1])
+		return err
 	case reflect.Int16:
-		b := make([]byte, 2)
-		binary.LittleEndian.PutUint16(b, uint16(v.Int()))
-		return b, nil
+		binary.LittleEndian.PutUint16(b[:], uint16(v.Int()))
+		_, err = w.Write(b[:2])
+		return err
 	case reflect.Uint16:
-		b := make([]byte, 2)
-		binary.LittleEndian.PutUint16(b, uint16(v.Uint()))
-		return b, nil
+		binary.LittleEndian.PutUint16(b[:], uint16(v.Uint()))
+		_, err = w.Write(b[:2])
+		return err
 	case reflect.Int32:
-		b := make([]byte, 4)
-		binary.LittleEndian.PutUint32(b, uint32(v.Int()))
-		return b, nil
+		binary.LittleEndian.PutUint32(b[:], uint32(v.Int()))
+		_, err = w.Write(b[:4])
+		return err
 	case reflect.Uint32:
-		b := make([]byte, 4)
-		binary.LittleEndian.PutUint32(b, uint32(v.Uint()))
-		return b, nil
+		binary.LittleEndian.PutUint32(b[:], uint32(v.Uint()))
+		_, err = w.Write(b[:4])
+		return err
 	case reflect.Int64:
-		b := make([]byte, 8)
-		binary.LittleEndian.PutUint64(b, uint64(v.Int()))
-		return b, nil
+		binary.LittleEndian.PutUint64(b[:], uint64(v.Int()))
+		_, err = w.Write(b[:8])
+		return err
 	case reflect.Uint64:
-		b := make([]byte, 8)
-		binary.LittleEndian.PutUint64(b, uint64(v.Uint()))
-		return b, nil
+		binary.LittleEndian.PutUint64(b[:], uint64(v.Uint()))
+		_, err = w.Write(b[:8])
+		return err
 	case reflect.Slice:
 		switch v.Type().Elem().Kind() {
 		case reflect.Uint8:
-			output := make([]byte, 8)
-			binary.LittleEndian.PutUint64(output, uint64(v.Len()))
-
-			for i := 0; i < v.Len(); i++ {
-				d, err := serializeData(v.Index(i))
-				if err != nil {
-					return nil, err
-				}
-				output = append(output, d...)
+			binary.LittleEndian.PutUint64(b[:], uint64(v.Len()))
+			if _, err = w.Write(b[:8]); err != nil {
+				return err
 			}
-			return output, nil
+			_, err = w.Write(v.Bytes())
+			return err
 		}
-		return nil, fmt.Errorf("unsupport type: %v, elem: %v", v.Kind(), v.Elem().Kind())
+		return fmt.Errorf("unsupport type: %v, elem: %v", v.Kind(), v.Type().Elem().Kind())
 	case reflect.Array:
 		switch v.Type().Elem().Kind() {
 		case reflect.Uint8:
-			b := make([]byte, 0, v.Len())
+			d := make([]byte, v.Len())
 			for i := 0; i < v.Len(); i++ {
-				b = append(b, byte(v.Index(i).Uint()))
+				d[i] = byte(v.Index(i).Uint())
 			}
-			return b, nil
+			_, err = w.Write(d)
+			return err
 		}
-		return nil, fmt.Errorf("unsupport type: %v, elem: %v", v.Kind(), v.Elem().Kind())
+		return fmt.Errorf("unsupport type: %v, elem: %v", v.Kind(), v.Type().Elem().Kind())
 	case reflect.String:
-		b := make([]byte, 8+len(v.String()))
-		binary.LittleEndian.PutUint64(b, uint64(len(v.String())))
-		copy(b[8:], []byte(v.String()))
-		return b, nil
+		binary.LittleEndian.PutUint64(b[:], uint64(len(v.String())))
+		if _, err = w.Write(b[:8]); err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, v.String())
+		return err
 	case reflect.Ptr:
 		if v.IsNil() {
-			return []byte{0}, nil
+			_, err = w.Write(b[:1])
+			return err
 		}
-		d, err := serializeData(v.Elem())
-		if err != nil {
-			return nil, err
-		}
-		b := make([]byte, 1+len(d))
 		b[0] = 1
-		copy(b[1:], d[:])
-		return b, nil
+		if _, err = w.Write(b[:1]); err != nil {
+			return err
+		}
+		return serializeTo(w, v.Elem())
 	case reflect.Struct:
-		data := make([]byte, 0, 1024)
 		for i := 0; i < v.NumField(); i++ {
-			field := v.Field(i)
-			d, err := serializeData(field)
-			if err != nil {
-				return nil, err
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err = serializeTo(w, v.Field(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Map:
+		// Go randomizes map iteration, so entries are written in ascending key order, as for a
+		// Rust BTreeMap, to keep the committed digest deterministic.
+		keys := v.MapKeys()
+		if err = sortMapKeys(keys); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(b[:], uint64(len(keys)))
+		if _, err = w.Write(b[:8]); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err = serializeTo(w, key); err != nil {
+				return err
+			}
+			if err = serializeTo(w, v.MapIndex(key)); err != nil {
+				return err
 			}
-			data = append(data, d...)
 		}
-		return data, nil
+		return nil
+	}
+	return fmt.Errorf("unsupport type: %v", v.Kind())
+}
+
+// sortMapKeys sorts map keys in ascending order. Only boolean, integer and string keys, which
+// have a natural order, are supported.
+func sortMapKeys(keys []reflect.Value) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	var compare func(a, b reflect.Value) int
+	switch keys[0].Kind() {
+	case reflect.Bool:
+		compare = func(a, b reflect.Value) int {
+			if a.Bool() == b.Bool() {
+				return 0
+			} else if b.Bool() {
+				return -1
+			}
+			return 1
+		}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		compare = func(a, b reflect.Value) int { return cmp.Compare(a.Int(), b.Int()) }
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		compare = func(a, b reflect.Value) int { return cmp.Compare(a.Uint(), b.Uint()) }
+	case reflect.String:
+		compare = func(a, b reflect.Value) int { return cmp.Compare(a.String(), b.String()) }
+	default:
+		return fmt.Errorf("unsupport map key type: %v", keys[0].Kind())
 	}
-	return nil, fmt.Errorf("unsupport type: %v", v.Kind())
+	slices.SortFunc(keys, compare)
+	return nil
 }
@@ -0,0 +1,10 @@
+//go:build !mipsle
+// +build !mipsle
+
+package zkvm_runtime
+
+// SerializeValue encodes v as a hint for Read, for host tooling preparing guest inputs. It is
+// SerializeData, so unsupported types are reported as errors rather than panics.
+func SerializeValue(v any) ([]byte, error) {
+	return SerializeData(v)
+}
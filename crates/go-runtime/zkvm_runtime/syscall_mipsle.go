@@ -0,0 +1,25 @@
+//go:build mipsle
+// +build mipsle
+
+package zkvm_runtime
+
+import "unsafe"
+
+func SyscallWrite(fd int, write_buf []byte, nbytes int) int
+func SyscallHintLen() int
+func SyscallHintRead(ptr []byte, len int)
+func SyscallCommit(index int, word uint32)
+func SyscallExit(code int)
+func SyscallKeccakSponge(input unsafe.Pointer, result unsafe.Pointer)
+
+// reservedInput returns the capacity bytes of the reserved input region starting at addr.
+func reservedInput(addr int, capacity int) []byte {
+	ptr := unsafe.Pointer(uintptr(addr))
+	return unsafe.Slice((*byte)(ptr), capacity)
+}
+
+// isSyscallExit reports whether a recovered panic value came from SyscallExit, which never
+// returns inside the VM.
+func isSyscallExit(r any) bool {
+	return false
+}
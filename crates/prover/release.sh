@@ -39,7 +39,7 @@ fi
 
 # Create Plonk archive
 cd ./build/plonk
-tar --exclude='srs.bin' --exclude='srs_lagrange.bin' -czvf "../../$PLONK_ARCHIVE" .
+tar --exclude='srs.bin' --exclude='srs.*.bin' --exclude='srs.*.bin.sha256' --exclude='srs_lagrange.bin' -czvf "../../$PLONK_ARCHIVE" .
 cd ../..
 if [ $? -ne 0 ]; then
     echo "Failed to create Plonk archive."
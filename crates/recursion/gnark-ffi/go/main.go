@@ -43,7 +43,10 @@ func ProvePlonkBn254(dataDir *C.char, witnessPath *C.char) *C.C_PlonkBn254Proof
 	dataDirString := C.GoString(dataDir)
 	witnessPathString := C.GoString(witnessPath)
 
-	zkmPlonkBn254Proof := zkm.ProvePlonk(dataDirString, witnessPathString)
+	zkmPlonkBn254Proof, err := zkm.ProvePlonk(dataDirString, witnessPathString)
+	if err != nil {
+		panic(err)
+	}
 
 	ms := C.malloc(C.sizeof_C_PlonkBn254Proof)
 	if ms == nil {
@@ -72,7 +75,9 @@ func BuildPlonkBn254(dataDir *C.char) {
 	// Sanity check the required arguments have been provided.
 	dataDirString := C.GoString(dataDir)
 
-	zkm.BuildPlonk(dataDirString)
+	if err := zkm.BuildPlonk(dataDirString); err != nil {
+		panic(err)
+	}
 }
 
 //export VerifyPlonkBn254
@@ -99,7 +104,7 @@ func TestPlonkBn254(witnessPath *C.char, constraintsJson *C.char) *C.char {
 	constraintsJsonString := C.GoString(constraintsJson)
 	os.Setenv("WITNESS_JSON", witnessPathString)
 	os.Setenv("CONSTRAINTS_JSON", constraintsJsonString)
-	err := TestMain()
+	err := TestMain(false)
 	testMutex.Unlock()
 	if err != nil {
 		return C.CString(err.Error())
@@ -141,7 +146,9 @@ func BuildGroth16Bn254(dataDir *C.char) {
 	// Sanity check the required arguments have been provided.
 	dataDirString := C.GoString(dataDir)
 
-	zkm.BuildGroth16(dataDirString)
+	if err := zkm.BuildGroth16(dataDirString); err != nil {
+		panic(err)
+	}
 }
 
 //export VerifyGroth16Bn254
@@ -166,8 +173,7 @@ func TestGroth16Bn254(witnessJson *C.char, constraintsJson *C.char) *C.char {
 	constraintsJsonString := C.GoString(constraintsJson)
 	os.Setenv("WITNESS_JSON", witnessPathString)
 	os.Setenv("CONSTRAINTS_JSON", constraintsJsonString)
-	os.Setenv("GROTH16", "1")
-	err := TestMain()
+	err := TestMain(true)
 	testMutex.Unlock()
 	if err != nil {
 		return C.CString(err.Error())
@@ -175,7 +181,9 @@ func TestGroth16Bn254(witnessJson *C.char, constraintsJson *C.char) *C.char {
 	return nil
 }
 
-func TestMain() error {
+// TestMain compiles, sets up and proves the circuit for the witness named by WITNESS_JSON, with
+// the Groth16 range checks if groth16 is set.
+func TestMain(groth16 bool) error {
 	// Get the file name from an environment variable.
 	fileName := os.Getenv("WITNESS_JSON")
 	if fileName == "" {
@@ -197,6 +205,9 @@ func TestMain() error {
 
 	// Compile the circuit.
 	circuit := zkm.NewCircuit(inputs)
+	if groth16 {
+		circuit = circuit.WithGroth16()
+	}
 	builder := scs.NewBuilder
 	scs, err := frontend.Compile(ecc.BN254.ScalarField(), builder, &circuit)
 	if err != nil {
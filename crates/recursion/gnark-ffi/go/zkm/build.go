@@ -1,11 +1,16 @@
 package zkm
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"io"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark-crypto/kzg"
@@ -13,287 +18,464 @@ import (
 	"github.com/consensys/gnark/backend/plonk"
 	"github.com/consensys/gnark/frontend"
 	"github.com/consensys/gnark/frontend/cs/r1cs"
-	"github.com/consensys/gnark/frontend/cs/scs"
 	"github.com/consensys/gnark/test/unsafekzg"
 	"github.com/ProjectZKM/zkm-recursion-gnark/zkm/trusted_setup"
 )
 
-func BuildPlonk(dataDir string) {
-	// Set the environment variable for the constraints file.
-	//
-	// TODO: There might be some non-determinism if a single process is running this command
-	// multiple times.
-	os.Setenv("CONSTRAINTS_JSON", dataDir+"/"+constraintsJsonFile)
+func BuildPlonk(dataDir string) error {
+	return BuildPlonkContext(context.Background(), dataDir)
+}
+
+// BuildPlonkContext is like BuildPlonk, but aborts the trusted setup download and returns
+// ctx.Err() when ctx is cancelled.
+func BuildPlonkContext(ctx context.Context, dataDir string) error {
+	return BuildPlonkWithConfig(ctx, dataDir, BuildConfig{})
+}
+
+// BuildConfig holds the optional settings of BuildPlonkWithConfig and BuildGroth16WithConfig.
+// The zero value matches BuildPlonk and BuildGroth16.
+type BuildConfig struct {
+	// DevInMemory keeps the dev mode SRS in memory instead of writing srsFile and
+	// srsLagrangeFile to dataDir. It has no effect outside dev mode.
+	DevInMemory bool
+	// Progress, if set, receives the progress of the trusted setup download. See
+	// trusted_setup.DownloadConfig.
+	Progress func(downloaded, total int64)
+	// HTTPClient, if set, issues the trusted setup download requests. See
+	// trusted_setup.DownloadConfig.
+	HTTPClient *http.Client
+	// SRSBaseURL, if set, is the base URL of a mirror of the Aztec ignition ceremony to download
+	// from. It must be https unless AllowHTTPSRSBaseURL is set.
+	SRSBaseURL          string
+	AllowHTTPSRSBaseURL bool
+	// MaxRetries is the number of times a failed trusted setup download request is retried. See
+	// trusted_setup.DownloadConfig.
+	MaxRetries int
+	// FullSRSCheck verifies the SRS cached for the circuit's size against the digest recorded
+	// when it was cached, which reads the whole file, instead of with the sampling
+	// trusted_setup.VerifySRSQuick.
+	FullSRSCheck bool
+	// SRSSHA256, if set, is the hex encoded sha256 the downloaded SRS must match, in place of
+	// trusted_setup.AztecIgnitionSrsSHA256. Both are digests of the whole ceremony, which is
+	// only kept until it is truncated to the circuit. Without either, the download is trusted
+	// once its contributions verify, with a warning that reports its digest. RequirePinnedSRS
+	// refuses to download the SRS instead.
+	SRSSHA256        string
+	RequirePinnedSRS bool
+	// Observer, if set, receives the duration of each build phase. It is the only setting used
+	// by BuildGroth16WithConfig.
+	Observer BuildObserver
+	// OutputSuffix, if set, is appended to the name of every artifact BuildPlonkWithConfig
+	// writes, leaving the artifacts of a previous build in place until PromoteArtifacts.
+	OutputSuffix string
+}
+
+// BuildObserver receives the duration of each phase of a build as it completes. The phases are,
+// in order, "compile", "srs" (PLONK only), "setup", "prove", "verify" and "export".
+type BuildObserver interface {
+	Phase(name string, d time.Duration)
+}
+
+// phaseTimer times consecutive build phases for an optional BuildObserver.
+type phaseTimer struct {
+	observer BuildObserver
+	start    time.Time
+}
 
-	// Read the file.
+func newPhaseTimer(observer BuildObserver) *phaseTimer {
+	return &phaseTimer{observer: observer, start: time.Now()}
+}
+
+// done reports the phase that ended now and starts timing the next one.
+func (p *phaseTimer) done(name string) {
+	now := time.Now()
+	if p.observer != nil {
+		p.observer.Phase(name, now.Sub(p.start))
+	}
+	p.start = now
+}
+
+// BuildPlonkWithConfig is like BuildPlonkContext, with the behavior adjusted by config.
+func BuildPlonkWithConfig(ctx context.Context, dataDir string, config BuildConfig) error {
+	phases := newPhaseTimer(config.Observer)
+
+	// Read the witness and initialize the circuit.
 	witnessInputPath := dataDir + "/" + plonkWitnessPath
-	data, err := os.ReadFile(witnessInputPath)
+	witnessFile, err := os.Open(witnessInputPath)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to read plonk witness: %w", err)
 	}
-
-	// Deserialize the JSON data into a slice of Instruction structs
-	var witnessInput WitnessInput
-	err = json.Unmarshal(data, &witnessInput)
+	defer witnessFile.Close()
+	circuit, witnessInput, err := NewCircuitFromReader(witnessFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to load plonk witness %s: %w", witnessInputPath, err)
 	}
+	circuit = circuit.WithConstraints(dataDir + "/" + constraintsJsonFile)
 
-	// Initialize the circuit.
-	circuit := NewCircuit(witnessInput)
-
-	// Compile the circuit.
-	scs, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, &circuit)
+	// Compile the circuit, or load it from a previous build.
+	scs, err := LoadOrCompilePlonk(dataDir, &circuit)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	phases.done("compile")
 
 	// Download the trusted setup.
 	var srs kzg.SRS = kzg.NewSRS(ecc.BN254)
 	var srsLagrange kzg.SRS = kzg.NewSRS(ecc.BN254)
 	srsFileName := dataDir + "/" + srsFile
 	srsLagrangeFileName := dataDir + "/" + srsLagrangeFile
+	srsDigestFileName := dataDir + "/" + srsDigestFile
+	srsLagrangeFingerprintFileName := dataDir + "/" + srsLagrangeFingerprintFile
 
-	srsLagrangeFile, err := os.Create(srsLagrangeFileName)
-	if err != nil {
-		log.Fatal("error creating srs file: ", err)
-		panic(err)
-	}
-	defer srsLagrangeFile.Close()
-
+	// srsDigest is the digest of the SRS this build recorded or verified, for the manifest.
+	var srsDigest string
 	if !strings.Contains(dataDir, "dev") {
-		if _, err := os.Stat(srsFileName); os.IsNotExist(err) {
-			fmt.Println("downloading aztec ignition srs")
-			trusted_setup.DownloadAndSaveAztecIgnitionSrs(174, srsFileName)
-
-			srsFile, err := os.Open(srsFileName)
-			if err != nil {
-				panic(err)
+		// Fail before the download if the circuit is too large for the trusted setup.
+		power, err := srsPower(scs.GetNbConstraints() + scs.GetNbPublicVariables())
+		if err != nil {
+			return err
+		}
+		srsPowerFileName := dataDir + "/" + fmt.Sprintf(srsPowerFile, power)
+		srsPowerDigestFileName := dataDir + "/" + fmt.Sprintf(srsPowerDigestFile, power)
+
+		if _, err := os.Stat(srsPowerFileName); os.IsNotExist(err) {
+			// The whole ceremony is only kept until it is truncated to the circuit. One left
+			// behind by an earlier build is used instead of downloading it again.
+			if _, err := os.Stat(srsFileName); os.IsNotExist(err) {
+				if _, err := pinnedSRSDigest(config); err != nil {
+					return err
+				}
+				os.Remove(srsDigestFileName)
+				fmt.Println("downloading aztec ignition srs")
+				err = trusted_setup.DownloadAndSaveAztecIgnitionSrsWithConfig(ctx, 174, srsFileName, trusted_setup.DownloadConfig{
+					Progress:   config.Progress,
+					HTTPClient: config.HTTPClient,
+					BaseURL:    config.SRSBaseURL,
+					AllowHTTP:  config.AllowHTTPSRSBaseURL,
+					MaxRetries: config.MaxRetries,
+				})
+				if err != nil {
+					return fmt.Errorf("failed to download aztec ignition srs: %w", err)
+				}
 			}
-			defer srsFile.Close()
-
-			_, err = srs.ReadFrom(srsFile)
-			if err != nil {
-				panic(err)
+			if err := checkSRSDownload(srsFileName, srsDigestFileName, config.srsDigest()); err != nil {
+				return err
 			}
-
-			srsLagrange = trusted_setup.ToLagrange(scs, srs)
-			_, err = srsLagrange.WriteTo(srsLagrangeFile)
+			srs, srsDigest, err = cacheSRSPower(srsFileName, srsDigestFileName, power, srsPowerFileName, srsPowerDigestFileName)
 			if err != nil {
-				panic(err)
+				return err
 			}
+			// A Lagrange SRS cached from a previous download is not trusted.
+			os.Remove(srsLagrangeFingerprintFileName)
 		} else {
-			srsFile, err := os.Open(srsFileName)
+			srsDigest, err = verifyCachedSRS(srsPowerFileName, srsPowerDigestFileName, config.FullSRSCheck)
 			if err != nil {
-				panic(err)
+				return err
 			}
-			defer srsFile.Close()
 
-			_, err = srs.ReadFrom(srsFile)
+			srsFile, err := os.Open(srsPowerFileName)
 			if err != nil {
-				panic(err)
+				return fmt.Errorf("failed to open srs file: %w", err)
 			}
+			defer srsFile.Close()
 
-			_, err = srsLagrange.ReadFrom(srsLagrangeFile)
+			_, err = srs.ReadFrom(srsFile)
 			if err != nil {
-				panic(err)
+				return fmt.Errorf("failed to read srs: %w", err)
 			}
+		}
 
+		srsLagrange, err = loadOrComputeLagrange(scs, srs, srsLagrangeFileName, srsLagrangeFingerprintFileName)
+		if err != nil {
+			return err
 		}
 	} else {
 		srs, srsLagrange, err = unsafekzg.NewSRS(scs)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("failed to generate dev srs: %w", err)
 		}
 
-		srsFile, err := os.Create(srsFileName)
-		if err != nil {
-			panic(err)
-		}
-		defer srsFile.Close()
+		if !config.DevInMemory {
+			srsFile, err := os.Create(srsFileName)
+			if err != nil {
+				return fmt.Errorf("failed to create srs file: %w", err)
+			}
+			defer srsFile.Close()
 
-		_, err = srs.WriteTo(srsFile)
-		if err != nil {
-			panic(err)
-		}
+			srsHash := sha256.New()
+			_, err = srs.WriteTo(io.MultiWriter(srsFile, srsHash))
+			if err != nil {
+				return fmt.Errorf("failed to write srs: %w", err)
+			}
+			srsDigest = hex.EncodeToString(srsHash.Sum(nil))
 
-		_, err = srsLagrange.WriteTo(srsLagrangeFile)
-		if err != nil {
-			panic(err)
+			srsLagrangeFile, err := os.Create(srsLagrangeFileName)
+			if err != nil {
+				return fmt.Errorf("error creating srs lagrange file: %w", err)
+			}
+			defer srsLagrangeFile.Close()
+			_, err = srsLagrange.WriteTo(srsLagrangeFile)
+			if err != nil {
+				return fmt.Errorf("failed to write srs lagrange: %w", err)
+			}
 		}
 	}
 
+	phases.done("srs")
+
 	// Generate the proving and verifying key.
 	pk, vk, err := plonk.Setup(scs, srs, srsLagrange)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to run plonk setup: %w", err)
 	}
+	phases.done("setup")
 
 	// Generate proof.
 	assignment := NewCircuit(witnessInput)
 	witness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to generate witness: %w", err)
 	}
 	proof, err := plonk.Prove(scs, pk, witness)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to generate proof: %w", err)
 	}
+	phases.done("prove")
 
 	// Verify proof.
 	publicWitness, err := witness.Public()
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to get public witness: %w", err)
 	}
 	err = plonk.Verify(proof, vk, publicWitness)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to verify proof: %w", err)
 	}
+	phases.done("verify")
 
 	// Create the build directory.
-	os.MkdirAll(dataDir, 0755)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create build directory: %w", err)
+	}
 
 	// Write the solidity verifier.
-	solidityVerifierFile, err := os.Create(dataDir + "/" + plonkVerifierContractPath)
+	solidityVerifierFile, err := os.Create(dataDir + "/" + plonkVerifierContractPath + config.OutputSuffix)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to create solidity verifier file: %w", err)
 	}
-	vk.ExportSolidity(solidityVerifierFile)
 	defer solidityVerifierFile.Close()
+	if err := ExportPlonkSolidity(vk, solidityVerifierFile); err != nil {
+		return err
+	}
 
 	// Write the R1CS.
-	scsFile, err := os.Create(dataDir + "/" + plonkCircuitPath)
+	scsFile, err := os.Create(dataDir + "/" + plonkCircuitPath + config.OutputSuffix)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to create scs file: %w", err)
 	}
 	defer scsFile.Close()
 	_, err = scs.WriteTo(scsFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to write scs: %w", err)
 	}
 
 	// Write the verifier key.
-	vkFile, err := os.Create(dataDir + "/" + plonkVkPath)
+	vkFile, err := os.Create(dataDir + "/" + plonkVkPath + config.OutputSuffix)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to create verifier key file: %w", err)
 	}
 	defer vkFile.Close()
 	_, err = vk.WriteTo(vkFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to write verifier key: %w", err)
 	}
 
 	// Write the proving key.
-	pkFile, err := os.Create(dataDir + "/" + plonkPkPath)
+	pkFile, err := os.Create(dataDir + "/" + plonkPkPath + config.OutputSuffix)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to create proving key file: %w", err)
 	}
 	defer pkFile.Close()
 	_, err = pk.WriteTo(pkFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to write proving key: %w", err)
 	}
+
+	// Write the build manifest.
+	manifest := newManifest(ecc.BN254, scs, srsDigest)
+	if err := writeManifest(dataDir+"/"+buildManifestPath+config.OutputSuffix, manifest); err != nil {
+		return err
+	}
+	phases.done("export")
+	return nil
 }
 
-func BuildGroth16(dataDir string) {
-	// Set the environment variable for the constraints file.
-	//
-	// TODO: There might be some non-determinism if a single process is running this command
-	// multiple times.
-	os.Setenv("CONSTRAINTS_JSON", dataDir+"/"+constraintsJsonFile)
-	os.Setenv("GROTH16", "1")
+// plonkArtifacts are the files written by BuildPlonk, in the order PromoteArtifacts renames them.
+// The verifier key goes last so that it never refers to a proving key not yet in place.
+var plonkArtifacts = []string{plonkCircuitPath, plonkPkPath, plonkVerifierContractPath, buildManifestPath, plonkVkPath}
+
+// PromoteArtifacts renames the artifacts written by BuildPlonkWithConfig with the given
+// OutputSuffix over those of the previous build in dataDir. It fails without renaming anything if
+// any artifact is missing. Each rename is atomic, but the set as a whole is not.
+func PromoteArtifacts(dataDir string, suffix string) error {
+	if suffix == "" {
+		return fmt.Errorf("empty artifact suffix")
+	}
+	for _, name := range plonkArtifacts {
+		if _, err := os.Stat(dataDir + "/" + name + suffix); err != nil {
+			return fmt.Errorf("failed to find artifact to promote: %w", err)
+		}
+	}
+	for _, name := range plonkArtifacts {
+		if err := os.Rename(dataDir+"/"+name+suffix, dataDir+"/"+name); err != nil {
+			return fmt.Errorf("failed to promote %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ExportPlonkSolidity writes the Solidity verifier contract for vk to w.
+func ExportPlonkSolidity(vk plonk.VerifyingKey, w io.Writer) error {
+	if err := vk.ExportSolidity(w); err != nil {
+		return fmt.Errorf("failed to export solidity verifier: %w", err)
+	}
+	return nil
+}
+
+func BuildGroth16(dataDir string) error {
+	return BuildGroth16WithConfig(dataDir, BuildConfig{})
+}
 
-	// Read the file.
+// BuildGroth16WithConfig is like BuildGroth16, reporting the build phases to config.Observer.
+func BuildGroth16WithConfig(dataDir string, config BuildConfig) error {
+	return buildGroth16(dataDir, ecc.BN254, false, config.Observer)
+}
+
+// BuildGroth16Curve is like BuildGroth16, but targets the given curve. The verifier and proving
+// keys are prefixed with a curve tag (see writeCurveTag) so that a loader can dispatch on it.
+func BuildGroth16Curve(dataDir string, curve ecc.ID) error {
+	if !slices.Contains(groth16Curves, curve) {
+		return fmt.Errorf("unsupported groth16 curve id: %d", curve)
+	}
+	return buildGroth16(dataDir, curve, true, nil)
+}
+
+func buildGroth16(dataDir string, curve ecc.ID, tagged bool, observer BuildObserver) error {
+	phases := newPhaseTimer(observer)
+
+	// Read the witness and initialize the circuit.
 	witnessInputPath := dataDir + "/" + groth16WitnessPath
-	data, err := os.ReadFile(witnessInputPath)
+	witnessFile, err := os.Open(witnessInputPath)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to read groth16 witness: %w", err)
 	}
-
-	// Deserialize the JSON data into a slice of Instruction structs
-	var witnessInput WitnessInput
-	err = json.Unmarshal(data, &witnessInput)
+	defer witnessFile.Close()
+	circuit, witnessInput, err := NewCircuitFromReader(witnessFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to load groth16 witness %s: %w", witnessInputPath, err)
 	}
-
-	// Initialize the circuit.
-	circuit := NewCircuit(witnessInput)
+	circuit = circuit.WithConstraints(dataDir + "/" + constraintsJsonFile).WithGroth16()
 
 	// Compile the circuit.
-	r1cs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+	r1cs, err := frontend.Compile(curve.ScalarField(), r1cs.NewBuilder, &circuit)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to compile circuit: %w", err)
+	}
+	if LogR1CSStats {
+		fmt.Println("[zkm] groth16 r1cs stats:", R1CSStats(r1cs))
 	}
+	phases.done("compile")
 
 	// Generate the proving and verifying key.
 	pk, vk, err := groth16.Setup(r1cs)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to run groth16 setup: %w", err)
 	}
+	phases.done("setup")
 
 	// Generate proof.
 	assignment := NewCircuit(witnessInput)
-	witness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
+	witness, err := frontend.NewWitness(&assignment, curve.ScalarField())
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to generate witness: %w", err)
 	}
 	proof, err := groth16.Prove(r1cs, pk, witness)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to generate proof: %w", err)
 	}
+	phases.done("prove")
 
 	// Verify proof.
 	publicWitness, err := witness.Public()
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to get public witness: %w", err)
 	}
 	err = groth16.Verify(proof, vk, publicWitness)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to verify proof: %w", err)
 	}
+	phases.done("verify")
 
 	// Create the build directory.
-	os.MkdirAll(dataDir, 0755)
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return fmt.Errorf("failed to create build directory: %w", err)
+	}
 
-	// Write the solidity verifier.
-	solidityVerifierFile, err := os.Create(dataDir + "/" + groth16VerifierContractPath)
-	if err != nil {
-		panic(err)
+	// Write the solidity verifier. gnark only supports this on BN254.
+	if curve == ecc.BN254 {
+		solidityVerifierFile, err := os.Create(dataDir + "/" + groth16VerifierContractPath)
+		if err != nil {
+			return fmt.Errorf("failed to create solidity verifier file: %w", err)
+		}
+		defer solidityVerifierFile.Close()
+		if err := vk.ExportSolidity(solidityVerifierFile); err != nil {
+			return fmt.Errorf("failed to export solidity verifier: %w", err)
+		}
 	}
-	vk.ExportSolidity(solidityVerifierFile)
-	defer solidityVerifierFile.Close()
 
 	// Write the R1CS.
 	r1csFile, err := os.Create(dataDir + "/" + groth16CircuitPath)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to create r1cs file: %w", err)
 	}
 	defer r1csFile.Close()
 	_, err = r1cs.WriteTo(r1csFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to write r1cs: %w", err)
 	}
 
 	// Write the verifier key.
 	vkFile, err := os.Create(dataDir + "/" + groth16VkPath)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to create verifier key file: %w", err)
 	}
 	defer vkFile.Close()
+	if tagged {
+		if err := writeCurveTag(vkFile, curve); err != nil {
+			return fmt.Errorf("failed to write verifier key curve tag: %w", err)
+		}
+	}
 	_, err = vk.WriteTo(vkFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to write verifier key: %w", err)
 	}
 
 	// Write the proving key.
 	pkFile, err := os.Create(dataDir + "/" + groth16PkPath)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to create proving key file: %w", err)
 	}
 	defer pkFile.Close()
+	if tagged {
+		if err := writeCurveTag(pkFile, curve); err != nil {
+			return fmt.Errorf("failed to write proving key curve tag: %w", err)
+		}
+	}
 	err = pk.WriteDump(pkFile)
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to write proving key: %w", err)
 	}
+	phases.done("export")
+
+	return nil
 }
@@ -0,0 +1,561 @@
+package zkm
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+)
+
+func TestBuildGroth16MissingWitness(t *testing.T) {
+	dataDir := t.TempDir()
+
+	err := BuildGroth16(dataDir)
+	if err == nil {
+		t.Fatal("expected an error for a data dir without a groth16 witness")
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected a not-exist error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), groth16WitnessPath) {
+		t.Fatalf("expected error to mention %s, got: %v", groth16WitnessPath, err)
+	}
+}
+
+// testConstraints is a tiny constraint system exposing v0 as the vkey hash and v0*v1 as the
+// committed values digest.
+const testConstraints = `[
+	{"opcode": "WitnessV", "args": [["v0"], ["0"]]},
+	{"opcode": "WitnessV", "args": [["v1"], ["1"]]},
+	{"opcode": "MulV", "args": [["v2"], ["v0"], ["v1"]]},
+	{"opcode": "CommitVkeyHash", "args": [["v0"]]},
+	{"opcode": "CommitCommittedValuesDigest", "args": [["v2"]]}
+]`
+
+const testWitness = `{
+	"vars": ["3", "5"],
+	"felts": [],
+	"exts": [],
+	"vkey_hash": "3",
+	"committed_values_digest": "15"
+}`
+
+// newTestDataDir returns a data dir holding testConstraints and testWitness as both the plonk
+// and groth16 witness.
+func newTestDataDir(t testing.TB) string {
+	t.Helper()
+	return writeTestDataDir(t, t.TempDir())
+}
+
+// newTestDevDataDir is like newTestDataDir, but returns a dev mode data dir.
+func newTestDevDataDir(t testing.TB) string {
+	t.Helper()
+	dataDir := filepath.Join(t.TempDir(), "dev")
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return writeTestDataDir(t, dataDir)
+}
+
+func writeTestDataDir(t testing.TB, dataDir string) string {
+	t.Helper()
+	files := map[string]string{
+		constraintsJsonFile: testConstraints,
+		plonkWitnessPath:    testWitness,
+		groth16WitnessPath:  testWitness,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dataDir
+}
+
+func TestBuildGroth16CurveBls12377(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	if err := BuildGroth16Curve(dataDir, ecc.BLS12_377); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, groth16VkPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(data)
+	curve, err := readCurveTag(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if curve != ecc.BLS12_377 {
+		t.Fatalf("expected curve tag %s, got %s", ecc.BLS12_377, curve)
+	}
+
+	vk := groth16.NewVerifyingKey(curve)
+	if _, err := vk.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := vk.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), data[curveTagSize:]) {
+		t.Fatal("verifying key does not round-trip through WriteTo/ReadFrom")
+	}
+}
+
+func TestLoadGroth16Keys(t *testing.T) {
+	bn254Dir := newTestDataDir(t)
+	if err := BuildGroth16(bn254Dir); err != nil {
+		t.Fatal(err)
+	}
+	bls12381Dir := newTestDataDir(t)
+	if err := BuildGroth16Curve(bls12381Dir, ecc.BLS12_381); err != nil {
+		t.Fatal(err)
+	}
+
+	// An untagged key on a curve other than BN254 is detected too.
+	tagged, err := os.ReadFile(filepath.Join(bls12381Dir, groth16VkPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	untaggedPath := filepath.Join(t.TempDir(), groth16VkPath)
+	if err := os.WriteFile(untaggedPath, tagged[curveTagSize:], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		curve ecc.ID
+	}{
+		{filepath.Join(bn254Dir, groth16VkPath), ecc.BN254},
+		{filepath.Join(bls12381Dir, groth16VkPath), ecc.BLS12_381},
+		{untaggedPath, ecc.BLS12_381},
+	}
+	for _, test := range tests {
+		vk, curve, err := LoadGroth16VerifyingKey(test.path)
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if curve != test.curve || vk.CurveID() != test.curve {
+			t.Fatalf("%s: expected curve %s, got %s with a %s key", test.path, test.curve, curve, vk.CurveID())
+		}
+	}
+
+	for dir, expected := range map[string]ecc.ID{bn254Dir: ecc.BN254, bls12381Dir: ecc.BLS12_381} {
+		pk, curve, err := LoadGroth16ProvingKey(filepath.Join(dir, groth16PkPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if curve != expected || pk.CurveID() != expected {
+			t.Fatalf("expected a %s proving key, got %s with a %s key", expected, curve, pk.CurveID())
+		}
+	}
+}
+
+func TestBuildGroth16KeepsGroth16Env(t *testing.T) {
+	for _, prior := range []string{"", "0"} {
+		t.Setenv("GROTH16", prior)
+		if prior == "" {
+			os.Unsetenv("GROTH16")
+		}
+
+		if err := BuildGroth16(newTestDataDir(t)); err != nil {
+			t.Fatal(err)
+		}
+		value, ok := os.LookupEnv("GROTH16")
+		if prior == "" && ok {
+			t.Fatalf("expected GROTH16 to stay unset, got %q", value)
+		}
+		if prior != "" && value != prior {
+			t.Fatalf("expected GROTH16 to stay %q, got %q", prior, value)
+		}
+	}
+}
+
+// testPermuteConstraints permutes a single witness felt with Poseidon2 KoalaBear.
+var testPermuteConstraints = `[
+	{"opcode": "WitnessV", "args": [["v0"], ["0"]]},
+	{"opcode": "WitnessV", "args": [["v1"], ["1"]]},
+	{"opcode": "MulV", "args": [["v2"], ["v0"], ["v1"]]},
+	{"opcode": "WitnessF", "args": [["f0"], ["0"]]},
+	{"opcode": "PermuteKoalaBear", "args": [` + strings.TrimSuffix(strings.Repeat(`["f0"], `, 16), ", ") + `]},
+	{"opcode": "CommitVkeyHash", "args": [["v0"]]},
+	{"opcode": "CommitCommittedValuesDigest", "args": [["v2"]]}
+]`
+
+func TestBuildGroth16NoCommitments(t *testing.T) {
+	witness := strings.Replace(testWitness, `"felts": []`, `"felts": ["1"]`, 1)
+	nbConstraints := map[string]int{}
+	for _, env := range []string{"", "1"} {
+		t.Setenv("GROTH16", env)
+		dataDir := t.TempDir()
+		files := map[string]string{
+			constraintsJsonFile: testPermuteConstraints,
+			groth16WitnessPath:  witness,
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := BuildGroth16(dataDir); err != nil {
+			t.Fatal(err)
+		}
+
+		r1csFile, err := os.Open(filepath.Join(dataDir, groth16CircuitPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r1csFile.Close()
+		cs := groth16.NewCS(ecc.BN254)
+		if _, err := cs.ReadFrom(r1csFile); err != nil {
+			t.Fatal(err)
+		}
+		if indexes := cs.GetCommitments().CommitmentIndexes(); len(indexes) != 0 {
+			t.Fatalf("GROTH16=%q: expected no commitments, got %v", env, indexes)
+		}
+		nbConstraints[env] = cs.GetNbConstraints()
+	}
+	if nbConstraints[""] != nbConstraints["1"] {
+		t.Fatalf("expected the r1cs not to depend on GROTH16, got %d and %d constraints", nbConstraints[""], nbConstraints["1"])
+	}
+}
+
+func TestBuildGroth16CurveUnsupported(t *testing.T) {
+	if err := BuildGroth16Curve(t.TempDir(), ecc.BW6_761); err == nil {
+		t.Fatal("expected an error for an unsupported curve")
+	}
+}
+
+func TestBuildPlonkDevInMemory(t *testing.T) {
+	dataDir := newTestDevDataDir(t)
+	if err := BuildPlonkWithConfig(context.Background(), dataDir, BuildConfig{DevInMemory: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{srsFile, srsLagrangeFile} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %s not to be written, got: %v", name, err)
+		}
+	}
+	for _, name := range []string{plonkCircuitPath, plonkVkPath, plonkPkPath} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); err != nil {
+			t.Fatalf("expected %s to be written: %v", name, err)
+		}
+	}
+}
+
+func TestBuildPlonkConcurrentConstraints(t *testing.T) {
+	// Concurrent builds must not read each other's constraints, nor the environment.
+	t.Setenv("CONSTRAINTS_JSON", filepath.Join(t.TempDir(), "missing.json"))
+
+	small := newTestDevDataDir(t)
+	large := newTestDevDataDir(t)
+	if err := os.WriteFile(filepath.Join(large, constraintsJsonFile), []byte(withExtraConstraints(64)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dataDirs := []string{small, large}
+	errs := make([]error, len(dataDirs))
+	var wg sync.WaitGroup
+	for i, dataDir := range dataDirs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = BuildPlonkWithConfig(context.Background(), dataDir, BuildConfig{DevInMemory: true})
+		}()
+	}
+	wg.Wait()
+
+	for i, dataDir := range dataDirs {
+		if errs[i] != nil {
+			t.Fatalf("build of %s failed: %v", dataDir, errs[i])
+		}
+		circuit := NewCircuit(validTestWitnessInput(t)).WithConstraints(filepath.Join(dataDir, constraintsJsonFile))
+		expected, err := frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, &circuit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scsFile, err := os.Open(filepath.Join(dataDir, plonkCircuitPath))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer scsFile.Close()
+		built := plonk.NewCS(ecc.BN254)
+		if _, err := built.ReadFrom(scsFile); err != nil {
+			t.Fatal(err)
+		}
+		if built.GetNbConstraints() != expected.GetNbConstraints() {
+			t.Fatalf("%s: expected %d constraints, got %d", dataDir, expected.GetNbConstraints(), built.GetNbConstraints())
+		}
+	}
+}
+
+func TestBuildPlonkSRSBaseURL(t *testing.T) {
+	// The ignition cache is written to ./data.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	var paths []string
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	defer mirror.Close()
+
+	config := BuildConfig{SRSBaseURL: mirror.URL, HTTPClient: mirror.Client(), SRSSHA256: testSRSSHA256}
+	err = BuildPlonkWithConfig(context.Background(), newTestDataDir(t), config)
+	if err == nil || !strings.Contains(err.Error(), "failed to download aztec ignition srs") {
+		t.Fatalf("expected the download from the mirror to fail, got: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/MAIN IGNITION/manifest.json" {
+		t.Fatalf("expected the build to fetch the manifest from the mirror, got %q", paths)
+	}
+}
+
+// testSRSSHA256 pins the SRS download of builds that never complete it.
+var testSRSSHA256 = strings.Repeat("0", 64)
+
+func TestBuildPlonkUnpinnedSRS(t *testing.T) {
+	// The ignition cache is written to ./data.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	var requests int
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer mirror.Close()
+
+	config := BuildConfig{SRSBaseURL: mirror.URL, HTTPClient: mirror.Client()}
+	err = BuildPlonkWithConfig(context.Background(), newTestDataDir(t), config)
+	if err == nil || !strings.Contains(err.Error(), "failed to download aztec ignition srs") {
+		t.Fatalf("expected the unpinned download to be attempted by default, got: %v", err)
+	}
+	if requests == 0 {
+		t.Fatal("expected the default build to download the srs")
+	}
+
+	requests = 0
+	config.RequirePinnedSRS = true
+	err = BuildPlonkWithConfig(context.Background(), newTestDataDir(t), config)
+	if !errors.Is(err, ErrSRSUnpinned) {
+		t.Fatalf("expected ErrSRSUnpinned, got: %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("expected no download without a pinned digest, got %d requests", requests)
+	}
+}
+
+func TestBuildPlonkMaxRetries(t *testing.T) {
+	// The ignition cache is written to ./data.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	var requests int
+	mirror := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer mirror.Close()
+
+	config := BuildConfig{SRSBaseURL: mirror.URL, HTTPClient: mirror.Client(), MaxRetries: -1, SRSSHA256: testSRSSHA256}
+	err = BuildPlonkWithConfig(context.Background(), newTestDataDir(t), config)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected the download from the mirror to fail with a 503, got: %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expected a single request with retries disabled, got %d", requests)
+	}
+}
+
+// recordingObserver records the phases reported by a build.
+type recordingObserver struct {
+	phases []string
+}
+
+func (r *recordingObserver) Phase(name string, d time.Duration) {
+	r.phases = append(r.phases, name)
+}
+
+func TestBuildObserver(t *testing.T) {
+	plonkObserver := &recordingObserver{}
+	if err := BuildPlonkWithConfig(context.Background(), newTestDevDataDir(t), BuildConfig{Observer: plonkObserver}); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"compile", "srs", "setup", "prove", "verify", "export"}
+	if !slices.Equal(plonkObserver.phases, expected) {
+		t.Fatalf("expected plonk phases %q, got %q", expected, plonkObserver.phases)
+	}
+
+	groth16Observer := &recordingObserver{}
+	if err := BuildGroth16WithConfig(newTestDataDir(t), BuildConfig{Observer: groth16Observer}); err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"compile", "setup", "prove", "verify", "export"}
+	if !slices.Equal(groth16Observer.phases, expected) {
+		t.Fatalf("expected groth16 phases %q, got %q", expected, groth16Observer.phases)
+	}
+}
+
+func TestBuildPlonkOutputSuffix(t *testing.T) {
+	dataDir := newTestDevDataDir(t)
+	if err := os.WriteFile(filepath.Join(dataDir, plonkVkPath), []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildPlonkWithConfig(context.Background(), dataDir, BuildConfig{OutputSuffix: ".new"}); err != nil {
+		t.Fatal(err)
+	}
+	previous, err := os.ReadFile(filepath.Join(dataDir, plonkVkPath))
+	if err != nil || string(previous) != "previous" {
+		t.Fatalf("expected the previous verifier key to be kept, got %q: %v", previous, err)
+	}
+	candidate, err := os.ReadFile(filepath.Join(dataDir, plonkVkPath+".new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PromoteArtifacts(dataDir, ".new"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range plonkArtifacts {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); err != nil {
+			t.Fatalf("expected %s to be promoted: %v", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dataDir, name+".new")); !errors.Is(err, os.ErrNotExist) {
+			t.Fatalf("expected %s.new to be renamed, got: %v", name, err)
+		}
+	}
+	promoted, err := os.ReadFile(filepath.Join(dataDir, plonkVkPath))
+	if err != nil || !bytes.Equal(promoted, candidate) {
+		t.Fatalf("expected the promoted verifier key to be the candidate: %v", err)
+	}
+
+	if err := PromoteArtifacts(dataDir, ".new"); err == nil {
+		t.Fatal("expected an error promoting missing artifacts")
+	}
+}
+
+func TestBuildPlonkDev(t *testing.T) {
+	dataDir := newTestDevDataDir(t)
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{srsFile, srsLagrangeFile} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); err != nil {
+			t.Fatalf("expected %s to be written: %v", name, err)
+		}
+	}
+}
+
+func TestExportPlonkSolidity(t *testing.T) {
+	dataDir := newTestDevDataDir(t)
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	vkFile, err := os.Open(filepath.Join(dataDir, plonkVkPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vkFile.Close()
+	vk := plonk.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(vkFile); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := ExportPlonkSolidity(vk, &buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, marker := range []string{"pragma solidity", "contract PlonkVerifier"} {
+		if !strings.Contains(buf.String(), marker) {
+			t.Fatalf("expected the exported verifier to contain %q", marker)
+		}
+	}
+
+	written, err := os.ReadFile(filepath.Join(dataDir, plonkVerifierContractPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, buf.Bytes()) {
+		t.Fatal("expected BuildPlonk to write the same verifier as ExportPlonkSolidity")
+	}
+}
+
+func TestBuildGroth16SolidityVerifier(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	if err := BuildGroth16(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	verifier, err := os.ReadFile(filepath.Join(dataDir, groth16VerifierContractPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(verifier, []byte("contract Verifier")) {
+		t.Fatalf("unexpected groth16 verifier contract:\n%s", verifier)
+	}
+}
+
+func TestPlonkVkeyHash(t *testing.T) {
+	dataDir := newTestDevDataDir(t)
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, plonkVkPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vk := plonk.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := PlonkVkeyHash(vk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sha256.Sum256(data)
+	if hash != hex.EncodeToString(expected[:]) {
+		t.Fatalf("expected the sha256 of %s, %x, got %s", plonkVkPath, expected, hash)
+	}
+}
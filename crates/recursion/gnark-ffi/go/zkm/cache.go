@@ -0,0 +1,97 @@
+package zkm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/scs"
+)
+
+// compilePlonk compiles a circuit for PlonK on BN254. It is a variable so that tests can observe
+// when LoadOrCompilePlonk recompiles.
+var compilePlonk = func(circuit frontend.Circuit) (constraint.ConstraintSystem, error) {
+	return frontend.Compile(ecc.BN254.ScalarField(), scs.NewBuilder, circuit)
+}
+
+// LoadOrCompilePlonk returns the compiled PlonK constraint system of circuit, reusing the copy
+// cached in dataDir by a previous call when possible. The cache file name embeds a hash of the
+// constraints file read by the circuit, so editing the constraints invalidates it.
+func LoadOrCompilePlonk(dataDir string, circuit frontend.Circuit) (constraint.ConstraintSystem, error) {
+	key, err := plonkCacheKey(circuit)
+	if err != nil {
+		return nil, err
+	}
+	cacheFileName := dataDir + "/" + fmt.Sprintf(plonkCircuitCachePath, key)
+
+	if cs := readPlonkCache(cacheFileName); cs != nil {
+		return cs, nil
+	}
+	// A missing or corrupt cache file is recompiled and overwritten below.
+
+	cs, err := compilePlonk(circuit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile circuit: %w", err)
+	}
+
+	tmpFileName := cacheFileName + ".part"
+	tmpFile, err := os.Create(tmpFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create scs cache file: %w", err)
+	}
+	if _, err := cs.WriteTo(tmpFile); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFileName)
+		return nil, fmt.Errorf("failed to write scs cache: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFileName)
+		return nil, fmt.Errorf("failed to write scs cache: %w", err)
+	}
+	if err := os.Rename(tmpFileName, cacheFileName); err != nil {
+		return nil, fmt.Errorf("failed to move scs cache into place: %w", err)
+	}
+	return cs, nil
+}
+
+// readPlonkCache returns the constraint system cached at cacheFileName, or nil if it is missing
+// or cannot be read.
+func readPlonkCache(cacheFileName string) constraint.ConstraintSystem {
+	cacheFile, err := os.Open(cacheFileName)
+	if err != nil {
+		return nil
+	}
+	defer cacheFile.Close()
+	cs := plonk.NewCS(ecc.BN254)
+	if _, err := cs.ReadFrom(cacheFile); err != nil {
+		return nil
+	}
+	return cs
+}
+
+// plonkCacheKey hashes everything the compiled circuit depends on: the constraints file, whether
+// Define range checks for Groth16 and, for a *Circuit, the number of witness values of each kind.
+func plonkCacheKey(circuit frontend.Circuit) (string, error) {
+	c, isCircuit := circuit.(*Circuit)
+	if !isCircuit {
+		c = &Circuit{}
+	}
+	fileName := c.constraintsFile()
+	constraints, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read constraints: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write(constraints)
+	fmt.Fprintf(h, "\x00groth16=%t", c.isGroth16())
+	if isCircuit {
+		fmt.Fprintf(h, "\x00vars=%d felts=%d exts=%d", len(c.Vars), len(c.Felts), len(c.Exts))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
@@ -0,0 +1,87 @@
+package zkm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+)
+
+// countCompiles wraps compilePlonk for the duration of the test and returns the number of
+// compilations so far.
+func countCompiles(t *testing.T) *int {
+	t.Helper()
+	compiles := 0
+	original := compilePlonk
+	compilePlonk = func(circuit frontend.Circuit) (constraint.ConstraintSystem, error) {
+		compiles++
+		return original(circuit)
+	}
+	t.Cleanup(func() { compilePlonk = original })
+	return &compiles
+}
+
+func TestLoadOrCompilePlonk(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	constraintsFileName := filepath.Join(dataDir, constraintsJsonFile)
+	t.Setenv("CONSTRAINTS_JSON", constraintsFileName)
+	compiles := countCompiles(t)
+
+	circuit := NewCircuit(validTestWitnessInput(t))
+	first, err := LoadOrCompilePlonk(dataDir, &circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := LoadOrCompilePlonk(dataDir, &circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *compiles != 1 {
+		t.Fatalf("expected the second call to load from cache, got %d compilations", *compiles)
+	}
+	if first.GetNbConstraints() != second.GetNbConstraints() {
+		t.Fatalf("cached system has %d constraints, compiled %d", second.GetNbConstraints(), first.GetNbConstraints())
+	}
+
+	// Editing the constraints invalidates the cache.
+	if err := os.WriteFile(constraintsFileName, []byte(withExtraConstraints(4)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	third, err := LoadOrCompilePlonk(dataDir, &circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *compiles != 2 {
+		t.Fatalf("expected a recompilation after editing the constraints, got %d compilations", *compiles)
+	}
+	if third.GetNbConstraints() <= first.GetNbConstraints() {
+		t.Fatalf("expected more constraints after editing, got %d", third.GetNbConstraints())
+	}
+}
+
+func TestLoadOrCompilePlonkCorruptCache(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	t.Setenv("CONSTRAINTS_JSON", filepath.Join(dataDir, constraintsJsonFile))
+	compiles := countCompiles(t)
+
+	circuit := NewCircuit(validTestWitnessInput(t))
+	if _, err := LoadOrCompilePlonk(dataDir, &circuit); err != nil {
+		t.Fatal(err)
+	}
+	cacheFiles, err := filepath.Glob(filepath.Join(dataDir, "plonk_circuit.*.cache"))
+	if err != nil || len(cacheFiles) != 1 {
+		t.Fatalf("expected one cache file, got %v (%v)", cacheFiles, err)
+	}
+	if err := os.WriteFile(cacheFiles[0], []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadOrCompilePlonk(dataDir, &circuit); err != nil {
+		t.Fatal(err)
+	}
+	if *compiles != 2 {
+		t.Fatalf("expected a corrupt cache to be recompiled, got %d compilations", *compiles)
+	}
+}
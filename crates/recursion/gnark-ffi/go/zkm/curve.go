@@ -0,0 +1,102 @@
+package zkm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+)
+
+// groth16Curves are the curves supported by BuildGroth16Curve, in the order in which
+// LoadGroth16VerifyingKey tries them for an untagged key.
+var groth16Curves = []ecc.ID{ecc.BN254, ecc.BLS12_381, ecc.BLS12_377}
+
+// curveTagMagic prefixes keys written by BuildGroth16Curve. It is followed by the big-endian
+// uint16 ecc.ID of the curve the key was generated on.
+var curveTagMagic = [4]byte{'Z', 'K', 'M', 'C'}
+
+const curveTagSize = len(curveTagMagic) + 2
+
+func writeCurveTag(w io.Writer, curve ecc.ID) error {
+	var tag [curveTagSize]byte
+	copy(tag[:], curveTagMagic[:])
+	binary.BigEndian.PutUint16(tag[len(curveTagMagic):], uint16(curve))
+	_, err := w.Write(tag[:])
+	return err
+}
+
+func readCurveTag(r io.Reader) (ecc.ID, error) {
+	var tag [curveTagSize]byte
+	if _, err := io.ReadFull(r, tag[:]); err != nil {
+		return ecc.UNKNOWN, fmt.Errorf("failed to read curve tag: %w", err)
+	}
+	if [4]byte(tag[:len(curveTagMagic)]) != curveTagMagic {
+		return ecc.UNKNOWN, fmt.Errorf("missing curve tag")
+	}
+	curve := ecc.ID(binary.BigEndian.Uint16(tag[len(curveTagMagic):]))
+	if !slices.Contains(ecc.Implemented(), curve) {
+		return ecc.UNKNOWN, fmt.Errorf("unknown curve id in tag: %d", uint16(curve))
+	}
+	return curve, nil
+}
+
+// LoadGroth16VerifyingKey reads the Groth16 verifying key at path and returns it along with its
+// curve. A key written by BuildGroth16Curve is dispatched on its curve tag. An untagged key, as
+// written by BuildGroth16, is decoded on each of groth16Curves in turn; the point checks reject
+// a key read on the wrong curve.
+func LoadGroth16VerifyingKey(path string) (groth16.VerifyingKey, ecc.ID, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ecc.UNKNOWN, fmt.Errorf("failed to read verifying key: %w", err)
+	}
+
+	if bytes.HasPrefix(data, curveTagMagic[:]) {
+		curve, err := readCurveTag(bytes.NewReader(data))
+		if err != nil {
+			return nil, ecc.UNKNOWN, err
+		}
+		vk := groth16.NewVerifyingKey(curve)
+		if _, err := vk.ReadFrom(bytes.NewReader(data[curveTagSize:])); err != nil {
+			return nil, ecc.UNKNOWN, fmt.Errorf("failed to read %s verifying key: %w", curve, err)
+		}
+		return vk, curve, nil
+	}
+
+	for _, curve := range groth16Curves {
+		vk := groth16.NewVerifyingKey(curve)
+		if n, err := vk.ReadFrom(bytes.NewReader(data)); err == nil && n == int64(len(data)) {
+			return vk, curve, nil
+		}
+	}
+	return nil, ecc.UNKNOWN, fmt.Errorf("untagged verifying key %s does not decode on any supported curve", path)
+}
+
+// LoadGroth16ProvingKey reads the Groth16 proving key dump at path and returns it along with its
+// curve. A key written by BuildGroth16Curve is dispatched on its curve tag; an untagged key is
+// one written by BuildGroth16, which always targets BN254.
+func LoadGroth16ProvingKey(path string) (groth16.ProvingKey, ecc.ID, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, ecc.UNKNOWN, fmt.Errorf("failed to open proving key: %w", err)
+	}
+	defer f.Close()
+	r := bufio.NewReaderSize(f, 1<<20)
+
+	curve := ecc.BN254
+	if prefix, err := r.Peek(len(curveTagMagic)); err == nil && bytes.Equal(prefix, curveTagMagic[:]) {
+		if curve, err = readCurveTag(r); err != nil {
+			return nil, ecc.UNKNOWN, err
+		}
+	}
+	pk := groth16.NewProvingKey(curve)
+	if err := pk.ReadDump(r); err != nil {
+		return nil, ecc.UNKNOWN, fmt.Errorf("failed to read %s proving key: %w", curve, err)
+	}
+	return pk, curve, nil
+}
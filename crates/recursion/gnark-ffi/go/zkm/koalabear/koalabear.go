@@ -6,10 +6,10 @@ package koalabear
 import "C"
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"math/big"
-	"os"
 
 	"github.com/consensys/gnark/constraint/solver"
 	"github.com/consensys/gnark/frontend"
@@ -39,8 +39,11 @@ type ExtensionVariable struct {
 type Chip struct {
 	api          frontend.API
 	RangeChecker frontend.Rangechecker
+	// groth16 selects binary decomposition over RangeChecker for range checks.
+	groth16 bool
 }
 
+// NewChip returns a chip range checking with RangeChecker, as PlonK circuits do.
 func NewChip(api frontend.API) *Chip {
 	return &Chip{
 		api:          api,
@@ -48,6 +51,22 @@ func NewChip(api frontend.API) *Chip {
 	}
 }
 
+// NewChipGroth16 returns a chip range checking by binary decomposition, as Groth16 circuits do.
+func NewChipGroth16(api frontend.API) *Chip {
+	chip := NewChip(api)
+	chip.groth16 = true
+	return chip
+}
+
+// checkBits constrains v to nbBits bits.
+func (c *Chip) checkBits(v frontend.Variable, nbBits int) {
+	if !c.groth16 {
+		c.RangeChecker.Check(v, nbBits)
+	} else {
+		c.api.ToBinary(v, nbBits)
+	}
+}
+
 func Zero() Variable {
 	return Variable{
 		Value:      frontend.Variable("0"),
@@ -80,6 +99,45 @@ func NewF(value string) Variable {
 	}
 }
 
+var (
+	// ErrEmpty is returned by ParseF for an empty string.
+	ErrEmpty = errors.New("empty value")
+	// ErrSyntax is returned by ParseF for a string that is not a decimal integer.
+	ErrSyntax = errors.New("not a decimal integer")
+	// ErrRange is returned by ParseF for an integer outside of [0, p).
+	ErrRange = errors.New("out of range for the koalabear prime")
+)
+
+// ParseError records a failed ParseF. Err is one of ErrEmpty, ErrSyntax or ErrRange.
+type ParseError struct {
+	Value string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("koalabear: parsing %q: %v", e.Value, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseF is NewF returning a *ParseError, instead of failing later in the solver, when value is
+// not the decimal representation of a koalabear element.
+func ParseF(value string) (Variable, error) {
+	if value == "" {
+		return Variable{}, &ParseError{Value: value, Err: ErrEmpty}
+	}
+	int_value, success := new(big.Int).SetString(value, 10)
+	if !success {
+		return Variable{}, &ParseError{Value: value, Err: ErrSyntax}
+	}
+	if int_value.Sign() < 0 || int_value.Cmp(modulus) >= 0 {
+		return Variable{}, &ParseError{Value: value, Err: ErrRange}
+	}
+	return NewF(value), nil
+}
+
 func NewE(value []string) ExtensionVariable {
 	a := NewF(value[0])
 	b := NewF(value[1])
@@ -96,6 +154,53 @@ func NewEConst(value []string) ExtensionVariable {
 	return ExtensionVariable{Value: [4]Variable{a, b, c, d}}
 }
 
+// FromUint32 returns v reduced modulo the koalabear prime as a constant Variable.
+func FromUint32(v uint32) Variable {
+	return reducedConst(new(big.Int).SetUint64(uint64(v)))
+}
+
+// Add returns a + b as a constant Variable. Unlike Chip.AddF it works on concrete values, for
+// computing assignments and expected values outside of a circuit.
+func Add(a, b Variable) Variable {
+	return reducedConst(new(big.Int).Add(constValue(a), constValue(b)))
+}
+
+// Mul returns a * b as a constant Variable. Unlike Chip.MulF it works on concrete values, for
+// computing assignments and expected values outside of a circuit.
+func Mul(a, b Variable) Variable {
+	return reducedConst(new(big.Int).Mul(constValue(a), constValue(b)))
+}
+
+func reducedConst(value *big.Int) Variable {
+	return NewFConst(value.Mod(value, modulus).String())
+}
+
+// constValue returns the concrete value held by v. It panics if v is not an assignment value.
+func constValue(v Variable) *big.Int {
+	switch value := v.Value.(type) {
+	case string:
+		result, success := new(big.Int).SetString(value, 0)
+		if !success {
+			panic("string to int conversion failed")
+		}
+		return result
+	case *big.Int:
+		return new(big.Int).Set(value)
+	case big.Int:
+		return new(big.Int).Set(&value)
+	case int:
+		return big.NewInt(int64(value))
+	case int64:
+		return big.NewInt(value)
+	case uint32:
+		return new(big.Int).SetUint64(uint64(value))
+	case uint64:
+		return new(big.Int).SetUint64(value)
+	default:
+		panic(fmt.Sprintf("unsupported koalabear value type %T", v.Value))
+	}
+}
+
 func Felts2Ext(a, b, c, d Variable) ExtensionVariable {
 	return ExtensionVariable{Value: [4]Variable{a, b, c, d}}
 }
@@ -159,11 +264,7 @@ func (c *Chip) invF(in Variable) Variable {
 		Value:      result[0],
 		UpperBound: new(big.Int).SetUint64(2147483648),
 	}
-	if os.Getenv("GROTH16") != "1" {
-		c.RangeChecker.Check(result[0], 31)
-	} else {
-		c.api.ToBinary(result[0], 31)
-	}
+	c.checkBits(result[0], 31)
 	product := c.MulF(in, xinv)
 	c.AssertIsEqualF(product, NewFConst("1"))
 
@@ -286,16 +387,8 @@ func (c *Chip) InvE(in ExtensionVariable) ExtensionVariable {
 	yinv := Variable{Value: result[1], UpperBound: new(big.Int).SetUint64(2147483648)}
 	zinv := Variable{Value: result[2], UpperBound: new(big.Int).SetUint64(2147483648)}
 	linv := Variable{Value: result[3], UpperBound: new(big.Int).SetUint64(2147483648)}
-	if os.Getenv("GROTH16") != "1" {
-		c.RangeChecker.Check(result[0], 31)
-		c.RangeChecker.Check(result[1], 31)
-		c.RangeChecker.Check(result[2], 31)
-		c.RangeChecker.Check(result[3], 31)
-	} else {
-		c.api.ToBinary(result[0], 31)
-		c.api.ToBinary(result[1], 31)
-		c.api.ToBinary(result[2], 31)
-		c.api.ToBinary(result[3], 31)
+	for i := 0; i < 4; i++ {
+		c.checkBits(result[i], 31)
 	}
 	out := ExtensionVariable{Value: [4]Variable{xinv, yinv, zinv, linv}}
 
@@ -363,11 +456,7 @@ func (p *Chip) reduceWithMaxBits(x frontend.Variable, maxNbBits uint64) frontend
 	quotient := result[0]
 	remainder := result[1]
 
-	if os.Getenv("GROTH16") != "1" {
-		p.RangeChecker.Check(quotient, int(maxNbBits-30))
-	} else {
-		p.api.ToBinary(quotient, int(maxNbBits-30))
-	}
+	p.checkBits(quotient, int(maxNbBits-30))
 
 	// Check that the remainder has size less than the KoalaBear modulus, by decomposing it into a 24
 	// bit limb and a 7 bit limb.
@@ -387,13 +476,8 @@ func (p *Chip) reduceWithMaxBits(x frontend.Variable, maxNbBits uint64) frontend
 		),
 		remainder,
 	)
-	if os.Getenv("GROTH16") != "1" {
-		p.RangeChecker.Check(highLimb, 7)
-		p.RangeChecker.Check(lowLimb, 24)
-	} else {
-		p.api.ToBinary(highLimb, 7)
-		p.api.ToBinary(lowLimb, 24)
-	}
+	p.checkBits(highLimb, 7)
+	p.checkBits(lowLimb, 24)
 
 	// If the most significant bits are all 1, then we need to check that the least significant bits
 	// are all zero in order for element to be less than the KoalaBear modulus. Otherwise, we don't
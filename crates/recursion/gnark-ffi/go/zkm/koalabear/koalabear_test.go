@@ -0,0 +1,97 @@
+package koalabear
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/test"
+)
+
+type testArithmeticCircuit struct {
+	A, B, Sum, Product frontend.Variable
+}
+
+func (circuit *testArithmeticCircuit) Define(api frontend.API) error {
+	chip := NewChip(api)
+	bound := new(big.Int).Set(modulus_sub_1)
+	a := Variable{Value: circuit.A, UpperBound: bound}
+	b := Variable{Value: circuit.B, UpperBound: bound}
+	chip.AssertIsEqualF(chip.AddF(a, b), Variable{Value: circuit.Sum, UpperBound: bound})
+	chip.AssertIsEqualF(chip.MulF(a, b), Variable{Value: circuit.Product, UpperBound: bound})
+	return nil
+}
+
+func TestArithmeticMatchesChip(t *testing.T) {
+	maxValue := uint32(modulus_sub_1.Uint64())
+	vectors := [][2]uint32{
+		{0, 0},
+		{0, 7},
+		{1, maxValue},
+		{maxValue, maxValue},
+		{123456789, 987654321},
+	}
+	for _, vector := range vectors {
+		a, b := FromUint32(vector[0]), FromUint32(vector[1])
+		assignment := testArithmeticCircuit{
+			A:       a.Value,
+			B:       b.Value,
+			Sum:     Add(a, b).Value,
+			Product: Mul(a, b).Value,
+		}
+		if err := test.IsSolved(&testArithmeticCircuit{}, &assignment, ecc.BN254.ScalarField()); err != nil {
+			t.Fatalf("%d, %d: %v", vector[0], vector[1], err)
+		}
+	}
+
+	wrong := testArithmeticCircuit{A: "2", B: "3", Sum: "6", Product: "6"}
+	if err := test.IsSolved(&testArithmeticCircuit{}, &wrong, ecc.BN254.ScalarField()); err == nil {
+		t.Fatal("expected a wrong sum not to satisfy the circuit")
+	}
+}
+
+func TestArithmeticEdges(t *testing.T) {
+	maxValue := FromUint32(uint32(modulus_sub_1.Uint64()))
+	if sum := Add(maxValue, One()); sum.Value != "0" {
+		t.Fatalf("expected (p-1) + 1 = 0, got %v", sum.Value)
+	}
+	if product := Mul(maxValue, maxValue); product.Value != "1" {
+		t.Fatalf("expected (p-1) * (p-1) = 1, got %v", product.Value)
+	}
+	if reduced := FromUint32(uint32(modulus.Uint64())); reduced.Value != "0" {
+		t.Fatalf("expected p to reduce to 0, got %v", reduced.Value)
+	}
+}
+
+func TestParseF(t *testing.T) {
+	tests := []struct {
+		value string
+		err   error
+	}{
+		{"", ErrEmpty},
+		{"not-a-number", ErrSyntax},
+		{"0x10", ErrSyntax},
+		{modulus.String(), ErrRange},
+		{"-1", ErrRange},
+	}
+	for _, test := range tests {
+		_, err := ParseF(test.value)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, test.err) {
+			t.Fatalf("ParseF(%q): expected a ParseError wrapping %v, got: %v", test.value, test.err, err)
+		}
+		if parseErr.Value != test.value {
+			t.Fatalf("ParseF(%q): expected the error to record the value, got %q", test.value, parseErr.Value)
+		}
+	}
+
+	f, err := ParseF(modulus_sub_1.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Value != modulus_sub_1.String() {
+		t.Fatalf("unexpected value: %v", f.Value)
+	}
+}
@@ -0,0 +1,69 @@
+package zkm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint"
+)
+
+// Manifest records the inputs that produced the artifacts of a build, so that downstream tooling
+// can tell which circuit and SRS a given vk/pk belongs to.
+type Manifest struct {
+	Curve           string    `json:"curve"`
+	ConstraintCount int       `json:"constraint_count"`
+	SRSDigest       string    `json:"srs_digest"`
+	GnarkVersion    string    `json:"gnark_version"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// WriteManifest writes m to buildManifestPath in dataDir.
+func WriteManifest(dataDir string, m Manifest) error {
+	return writeManifest(dataDir+"/"+buildManifestPath, m)
+}
+
+func writeManifest(path string, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode build manifest: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write build manifest: %w", err)
+	}
+	return nil
+}
+
+// newManifest describes a build of cs on curve with the SRS of the given digest. srsDigest is left
+// empty when the build neither recorded nor verified the digest of its SRS.
+func newManifest(curve ecc.ID, cs constraint.ConstraintSystem, srsDigest string) Manifest {
+	return Manifest{
+		Curve:           curve.String(),
+		ConstraintCount: cs.GetNbConstraints(),
+		SRSDigest:       srsDigest,
+		GnarkVersion:    gnarkVersion(),
+		Timestamp:       time.Now().UTC(),
+	}
+}
+
+// gnarkVersion returns the version of the gnark module linked into the binary, following any
+// replace directive, or "unknown" without build info.
+func gnarkVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != "github.com/consensys/gnark" {
+			continue
+		}
+		if dep.Replace != nil {
+			return dep.Replace.Path + "@" + dep.Replace.Version
+		}
+		return dep.Path + "@" + dep.Version
+	}
+	return "unknown"
+}
@@ -0,0 +1,121 @@
+package zkm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/plonk"
+)
+
+func TestBuildPlonkWritesManifest(t *testing.T) {
+	dataDir := newTestDevDataDir(t)
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, buildManifestPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	scsFile, err := os.Open(filepath.Join(dataDir, plonkCircuitPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer scsFile.Close()
+	scs := plonk.NewCS(ecc.BN254)
+	if _, err := scs.ReadFrom(scsFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.ConstraintCount != scs.GetNbConstraints() {
+		t.Fatalf("expected %d constraints in the manifest, got %d", scs.GetNbConstraints(), manifest.ConstraintCount)
+	}
+	if manifest.Curve != ecc.BN254.String() {
+		t.Fatalf("expected curve %s, got %s", ecc.BN254, manifest.Curve)
+	}
+	if len(manifest.SRSDigest) != 64 {
+		t.Fatalf("expected the digest of the dev srs, got %q", manifest.SRSDigest)
+	}
+	if !strings.Contains(manifest.GnarkVersion, "gnark") {
+		t.Fatalf("expected a gnark module version, got %q", manifest.GnarkVersion)
+	}
+	if manifest.Timestamp.IsZero() {
+		t.Fatal("expected a build timestamp")
+	}
+}
+
+func TestBuildManifestSRSDigest(t *testing.T) {
+	// A stale srs.bin that the in-memory dev build does not use must not be reported.
+	dataDir := newTestDevDataDir(t)
+	if err := os.WriteFile(filepath.Join(dataDir, srsFile), []byte("stale srs"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildPlonkWithConfig(context.Background(), dataDir, BuildConfig{DevInMemory: true}); err != nil {
+		t.Fatal(err)
+	}
+	if manifest := readTestManifest(t, dataDir); manifest.SRSDigest != "" {
+		t.Fatalf("expected no srs digest for an in-memory srs, got %q", manifest.SRSDigest)
+	}
+
+	// Truncating the downloaded SRS records the digest of the cached truncation.
+	dataDir = newTestDataDir(t)
+	writeTestSRS(t, dataDir)
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := PlanBuild(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srsData, err := os.ReadFile(filepath.Join(dataDir, fmt.Sprintf(srsPowerFile, plan.SRSPower)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(srsData)
+	recorded := hex.EncodeToString(digest[:])
+	if manifest := readTestManifest(t, dataDir); manifest.SRSDigest != recorded {
+		t.Fatalf("expected the recorded srs digest %s, got %q", recorded, manifest.SRSDigest)
+	}
+
+	// A cached SRS only checked with VerifySRSQuick is not hashed.
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	if manifest := readTestManifest(t, dataDir); manifest.SRSDigest != "" {
+		t.Fatalf("expected no srs digest for an unverified cached srs, got %q", manifest.SRSDigest)
+	}
+
+	// A full check against the recorded digest reports it.
+	if err := BuildPlonkWithConfig(context.Background(), dataDir, BuildConfig{FullSRSCheck: true}); err != nil {
+		t.Fatal(err)
+	}
+	if manifest := readTestManifest(t, dataDir); manifest.SRSDigest != recorded {
+		t.Fatalf("expected the verified srs digest %s, got %q", recorded, manifest.SRSDigest)
+	}
+}
+
+func readTestManifest(t *testing.T, dataDir string) Manifest {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dataDir, buildManifestPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
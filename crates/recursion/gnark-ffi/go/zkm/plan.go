@@ -0,0 +1,96 @@
+package zkm
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// BuildPlan describes what BuildPlonk would do for a data dir, without running the setup.
+type BuildPlan struct {
+	// DevMode is set for data dirs built with an unsafe dev SRS.
+	DevMode bool
+	// ConstraintCount and PublicVariables describe the compiled circuit.
+	ConstraintCount int
+	PublicVariables int
+	// SRSPower is the log2 of the setup domain; the setup reads 2^SRSPower+3 SRS points.
+	SRSPower  int
+	SRSPoints int
+	// CircuitCached, SRSCached and LagrangeCached report which inputs the build can reuse from
+	// dataDir instead of compiling, downloading or computing them.
+	CircuitCached  bool
+	SRSCached      bool
+	LagrangeCached bool
+	// Actions lists the expensive steps of the build, in order.
+	Actions []string
+	// Files lists the files the build would write to dataDir.
+	Files []string
+}
+
+// PlanBuild reports what BuildPlonk(dataDir) would do. It compiles the circuit, unless it is
+// cached, but writes nothing and runs neither the setup nor the prover.
+func PlanBuild(dataDir string) (BuildPlan, error) {
+	witnessInputPath := dataDir + "/" + plonkWitnessPath
+	witnessFile, err := os.Open(witnessInputPath)
+	if err != nil {
+		return BuildPlan{}, fmt.Errorf("failed to read plonk witness: %w", err)
+	}
+	defer witnessFile.Close()
+	circuit, _, err := NewCircuitFromReader(witnessFile)
+	if err != nil {
+		return BuildPlan{}, fmt.Errorf("failed to load plonk witness %s: %w", witnessInputPath, err)
+	}
+	circuit = circuit.WithConstraints(dataDir + "/" + constraintsJsonFile)
+
+	plan := BuildPlan{DevMode: strings.Contains(dataDir, "dev")}
+
+	key, err := plonkCacheKey(&circuit)
+	if err != nil {
+		return BuildPlan{}, err
+	}
+	cacheFileName := fmt.Sprintf(plonkCircuitCachePath, key)
+	scs := readPlonkCache(dataDir + "/" + cacheFileName)
+	plan.CircuitCached = scs != nil
+	if !plan.CircuitCached {
+		scs, err = compilePlonk(&circuit)
+		if err != nil {
+			return BuildPlan{}, fmt.Errorf("failed to compile circuit: %w", err)
+		}
+		plan.Actions = append(plan.Actions, "compile circuit")
+		plan.Files = append(plan.Files, cacheFileName)
+	}
+	plan.ConstraintCount = scs.GetNbConstraints()
+	plan.PublicVariables = scs.GetNbPublicVariables()
+	plan.SRSPower, err = srsPower(plan.ConstraintCount + plan.PublicVariables)
+	if err != nil {
+		return BuildPlan{}, err
+	}
+	plan.SRSPoints = 1<<plan.SRSPower + 3
+
+	if plan.DevMode {
+		plan.Actions = append(plan.Actions, "generate dev srs")
+		plan.Files = append(plan.Files, srsFile, srsLagrangeFile)
+	} else {
+		srsPowerFileName := fmt.Sprintf(srsPowerFile, plan.SRSPower)
+		_, err := os.Stat(dataDir + "/" + srsPowerFileName)
+		plan.SRSCached = err == nil
+		if !plan.SRSCached {
+			if _, err := os.Stat(dataDir + "/" + srsFile); err != nil {
+				plan.Actions = append(plan.Actions, "download aztec ignition srs")
+			}
+			plan.Actions = append(plan.Actions, "truncate srs")
+			plan.Files = append(plan.Files, srsPowerFileName, fmt.Sprintf(srsPowerDigestFile, plan.SRSPower))
+		}
+
+		recorded, err := os.ReadFile(dataDir + "/" + srsLagrangeFingerprintFile)
+		plan.LagrangeCached = plan.SRSCached && err == nil && strings.TrimSpace(string(recorded)) == lagrangeFingerprint(scs)
+		if !plan.LagrangeCached {
+			plan.Actions = append(plan.Actions, "compute lagrange srs")
+			plan.Files = append(plan.Files, srsLagrangeFile, srsLagrangeFingerprintFile)
+		}
+	}
+
+	plan.Actions = append(plan.Actions, "run plonk setup", "prove and verify test proof")
+	plan.Files = append(plan.Files, plonkVerifierContractPath, plonkCircuitPath, plonkVkPath, plonkPkPath, buildManifestPath)
+	return plan, nil
+}
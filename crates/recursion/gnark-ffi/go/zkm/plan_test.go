@@ -0,0 +1,56 @@
+package zkm
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestPlanBuild(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	plan, err := PlanBuild(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.DevMode || plan.SRSCached || plan.LagrangeCached || plan.CircuitCached {
+		t.Fatalf("expected nothing to be cached in a clean data dir, got %+v", plan)
+	}
+	srsPowerFileName := fmt.Sprintf(srsPowerFile, plan.SRSPower)
+	if !slices.Contains(plan.Actions, "download aztec ignition srs") || !slices.Contains(plan.Files, srsPowerFileName) {
+		t.Fatalf("expected the plan to download the srs, got %+v", plan)
+	}
+	if plan.ConstraintCount == 0 || 1<<plan.SRSPower <= plan.ConstraintCount+plan.PublicVariables {
+		t.Fatalf("unexpected circuit size in plan: %+v", plan)
+	}
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected PlanBuild to write nothing, data dir holds %d files", len(entries))
+	}
+
+	writeTestSRS(t, dataDir)
+	plan, err = PlanBuild(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slices.Contains(plan.Actions, "download aztec ignition srs") || !slices.Contains(plan.Actions, "truncate srs") {
+		t.Fatalf("expected the plan to truncate the downloaded srs, got %+v", plan.Actions)
+	}
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	plan, err = PlanBuild(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.SRSCached || !plan.LagrangeCached || !plan.CircuitCached {
+		t.Fatalf("expected the built data dir to be fully cached, got %+v", plan)
+	}
+	if slices.Contains(plan.Files, srsPowerFileName) || slices.Contains(plan.Files, srsLagrangeFile) {
+		t.Fatalf("expected the plan not to rewrite the srs, got %+v", plan.Files)
+	}
+}
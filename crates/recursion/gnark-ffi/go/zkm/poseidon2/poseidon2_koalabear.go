@@ -16,10 +16,12 @@ type Poseidon2KoalaBearChip struct {
 	fieldApi *koalabear.Chip
 }
 
-func NewKoalaBearChip(api frontend.API) *Poseidon2KoalaBearChip {
+// NewKoalaBearChip returns a chip permuting with the field operations, and so the range checks,
+// of fieldApi.
+func NewKoalaBearChip(api frontend.API, fieldApi *koalabear.Chip) *Poseidon2KoalaBearChip {
 	return &Poseidon2KoalaBearChip{
 		api:      api,
-		fieldApi: koalabear.NewChip(api),
+		fieldApi: fieldApi,
 	}
 }
 
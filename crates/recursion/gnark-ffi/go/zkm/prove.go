@@ -2,15 +2,18 @@ package zkm
 
 import (
 	"bufio"
-	"encoding/json"
+	"context"
 	"fmt"
+	"math/big"
 	"os"
 	"sync"
 	"time"
 
 	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
 )
@@ -21,157 +24,235 @@ var globalR1csInitialized = false
 var globalPk groth16.ProvingKey = groth16.NewProvingKey(ecc.BN254)
 var globalPkInitialized = false
 
-func ProvePlonk(dataDir string, witnessPath string) Proof {
+// ProvePlonk proves the witness at witnessPath against the PlonK circuit and keys built into
+// dataDir by BuildPlonk, verifies the proof and returns it encoded as a Proof.
+func ProvePlonk(dataDir string, witnessPath string) (Proof, error) {
 	// Sanity check the required arguments have been provided.
 	if dataDir == "" {
-		panic("dataDirStr is required")
+		return Proof{}, fmt.Errorf("dataDirStr is required")
 	}
 	os.Setenv("CONSTRAINTS_JSON", dataDir+"/"+constraintsJsonFile)
 
 	// Read the R1CS.
 	scsFile, err := os.Open(dataDir + "/" + plonkCircuitPath)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to open scs file: %w", err)
 	}
-	scs := plonk.NewCS(ecc.BN254)
-	scs.ReadFrom(scsFile)
 	defer scsFile.Close()
+	scs := plonk.NewCS(ecc.BN254)
+	if _, err := scs.ReadFrom(scsFile); err != nil {
+		return Proof{}, fmt.Errorf("failed to read scs: %w", err)
+	}
 
 	// Read the proving key.
 	pkFile, err := os.Open(dataDir + "/" + plonkPkPath)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to open proving key file: %w", err)
 	}
+	defer pkFile.Close()
 	pk := plonk.NewProvingKey(ecc.BN254)
 	bufReader := bufio.NewReaderSize(pkFile, 1024*1024)
-	pk.UnsafeReadFrom(bufReader)
-	defer pkFile.Close()
+	if _, err := pk.UnsafeReadFrom(bufReader); err != nil {
+		return Proof{}, fmt.Errorf("failed to read proving key: %w", err)
+	}
 
 	// Read the verifier key.
 	vkFile, err := os.Open(dataDir + "/" + plonkVkPath)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to open verifier key file: %w", err)
 	}
-	vk := plonk.NewVerifyingKey(ecc.BN254)
-	vk.ReadFrom(vkFile)
 	defer vkFile.Close()
+	vk := plonk.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(vkFile); err != nil {
+		return Proof{}, fmt.Errorf("failed to read verifier key: %w", err)
+	}
 
-	// Read the file.
-	data, err := os.ReadFile(witnessPath)
+	// Read the witness.
+	witnessFile, err := os.Open(witnessPath)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to read plonk witness: %w", err)
 	}
-
-	// Deserialize the JSON data into a slice of Instruction structs
-	var witnessInput WitnessInput
-	err = json.Unmarshal(data, &witnessInput)
+	defer witnessFile.Close()
+	assignment, witnessInput, err := NewCircuitFromReader(witnessFile)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to load plonk witness %s: %w", witnessPath, err)
 	}
 
 	// Generate the witness.
-	assignment := NewCircuit(witnessInput)
 	witness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to generate witness: %w", err)
 	}
 	publicWitness, err := witness.Public()
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to get public witness: %w", err)
+	}
+
+	if err := AssertPublicConsistency(witnessInput, publicWitness); err != nil {
+		return Proof{}, err
 	}
 
 	// Generate the proof.
 	proof, err := plonk.Prove(scs, pk, witness)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to generate proof: %w", err)
 	}
 
 	// Verify proof.
 	err = plonk.Verify(proof, vk, publicWitness)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to verify proof: %w", err)
 	}
 
 	return NewZKMPlonkBn254Proof(&proof, witnessInput)
 }
 
+// AssertPublicConsistency checks that publicWitness assigns exactly the vkey hash and committed
+// values digest claimed by witnessInput. Claimed values that are not canonical field elements
+// are reduced by the solver, so the proof would commit to a different value than the one
+// reported in its PublicInputs.
+func AssertPublicConsistency(witnessInput WitnessInput, publicWitness witness.Witness) error {
+	vector, ok := publicWitness.Vector().(fr.Vector)
+	if !ok {
+		return fmt.Errorf("expected a BN254 public witness, got %s", typeName(publicWitness.Vector()))
+	}
+	claimed := []struct {
+		name  string
+		value string
+	}{
+		{"vkey hash", witnessInput.VkeyHash},
+		{"committed values digest", witnessInput.CommittedValuesDigest},
+	}
+	if len(vector) < len(claimed) {
+		return fmt.Errorf("public witness has %d values, expected at least %d", len(vector), len(claimed))
+	}
+	for i, c := range claimed {
+		expected, ok := new(big.Int).SetString(c.value, 10)
+		if !ok {
+			return fmt.Errorf("invalid %s %q", c.name, c.value)
+		}
+		var actual big.Int
+		vector[i].BigInt(&actual)
+		if actual.Cmp(expected) != 0 {
+			return fmt.Errorf("public witness assigns %s %s, witness input claims %s", c.name, actual.String(), c.value)
+		}
+	}
+	return nil
+}
+
 func ProveGroth16(dataDir string, witnessPath string) Proof {
+	proof, err := ProveGroth16Context(context.Background(), dataDir, witnessPath)
+	if err != nil {
+		panic(err)
+	}
+	return proof
+}
+
+// ProveGroth16Context is like ProveGroth16, but returns errors instead of panicking and returns
+// ctx.Err() when ctx is cancelled. gnark's solver and prover cannot be interrupted, so ctx is
+// checked between the loading, witness generation and proving steps.
+func ProveGroth16Context(ctx context.Context, dataDir string, witnessPath string) (Proof, error) {
 	// Sanity check the required arguments have been provided.
 	if dataDir == "" {
-		panic("dataDirStr is required")
+		return Proof{}, fmt.Errorf("dataDirStr is required")
+	}
+	if err := ctx.Err(); err != nil {
+		return Proof{}, err
 	}
 
 	start := time.Now()
 	os.Setenv("CONSTRAINTS_JSON", dataDir+"/"+constraintsJsonFile)
-	os.Setenv("GROTH16", "1")
 	fmt.Printf("Setting environment variables took %s\n", time.Since(start))
 
-	// Read the R1CS.
-	globalMutex.Lock()
-	if !globalR1csInitialized {
-		start = time.Now()
-		r1csFile, err := os.Open(dataDir + "/" + groth16CircuitPath)
-		if err != nil {
-			panic(err)
-		}
-		r1csReader := bufio.NewReaderSize(r1csFile, 1024*1024)
-		globalR1cs.ReadFrom(r1csReader)
-		defer r1csFile.Close()
-		globalR1csInitialized = true
-		fmt.Printf("Reading R1CS took %s\n", time.Since(start))
+	// Read the R1CS and the proving key.
+	if err := loadGroth16Globals(dataDir); err != nil {
+		return Proof{}, err
 	}
-	globalMutex.Unlock()
-
-	// Read the proving key.
-	globalMutex.Lock()
-	if !globalPkInitialized {
-		start = time.Now()
-		pkFile, err := os.Open(dataDir + "/" + groth16PkPath)
-		if err != nil {
-			panic(err)
-		}
-		pkReader := bufio.NewReaderSize(pkFile, 1024*1024)
-		globalPk.ReadDump(pkReader)
-		defer pkFile.Close()
-		globalPkInitialized = true
-		fmt.Printf("Reading proving key took %s\n", time.Since(start))
+	if err := ctx.Err(); err != nil {
+		return Proof{}, err
 	}
-	globalMutex.Unlock()
 
 	start = time.Now()
-	// Read the file.
-	data, err := os.ReadFile(witnessPath)
+	// Read the witness.
+	witnessFile, err := os.Open(witnessPath)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to read groth16 witness: %w", err)
 	}
-	fmt.Printf("Reading witness file took %s\n", time.Since(start))
-
-	start = time.Now()
-	// Deserialize the JSON data into a slice of Instruction structs
-	var witnessInput WitnessInput
-	err = json.Unmarshal(data, &witnessInput)
+	defer witnessFile.Close()
+	assignment, witnessInput, err := NewCircuitFromReader(witnessFile)
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to load groth16 witness %s: %w", witnessPath, err)
 	}
-	fmt.Printf("Deserializing JSON data took %s\n", time.Since(start))
+	fmt.Printf("Reading witness file took %s\n", time.Since(start))
 
 	start = time.Now()
 	// Generate the witness.
-	assignment := NewCircuit(witnessInput)
 	witness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
 	if err != nil {
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to generate witness: %w", err)
+	}
+	publicWitness, err := witness.Public()
+	if err != nil {
+		return Proof{}, fmt.Errorf("failed to get public witness: %w", err)
+	}
+	if err := AssertPublicConsistency(witnessInput, publicWitness); err != nil {
+		return Proof{}, err
 	}
 	fmt.Printf("Generating witness took %s\n", time.Since(start))
+	if err := ctx.Err(); err != nil {
+		return Proof{}, err
+	}
 
 	start = time.Now()
 	// Generate the proof.
+	globalMutex.RLock()
 	proof, err := groth16.Prove(globalR1cs, globalPk, witness)
+	globalMutex.RUnlock()
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		panic(err)
+		return Proof{}, fmt.Errorf("failed to generate proof: %w", err)
 	}
 	fmt.Printf("Generating proof took %s\n", time.Since(start))
+	if err := ctx.Err(); err != nil {
+		return Proof{}, err
+	}
 
 	return NewZKMGroth16Proof(&proof, witnessInput)
 }
+
+// loadGroth16Globals reads the groth16 R1CS and proving key in dataDir into globalR1cs and
+// globalPk, unless a previous call already did.
+func loadGroth16Globals(dataDir string) error {
+	globalMutex.Lock()
+	defer globalMutex.Unlock()
+
+	if !globalR1csInitialized {
+		start := time.Now()
+		r1csFile, err := os.Open(dataDir + "/" + groth16CircuitPath)
+		if err != nil {
+			return fmt.Errorf("failed to open r1cs file: %w", err)
+		}
+		defer r1csFile.Close()
+		r1csReader := bufio.NewReaderSize(r1csFile, 1024*1024)
+		if _, err := globalR1cs.ReadFrom(r1csReader); err != nil {
+			return fmt.Errorf("failed to read r1cs: %w", err)
+		}
+		globalR1csInitialized = true
+		fmt.Printf("Reading R1CS took %s\n", time.Since(start))
+	}
+
+	if !globalPkInitialized {
+		start := time.Now()
+		pkFile, err := os.Open(dataDir + "/" + groth16PkPath)
+		if err != nil {
+			return fmt.Errorf("failed to open proving key file: %w", err)
+		}
+		defer pkFile.Close()
+		pkReader := bufio.NewReaderSize(pkFile, 1024*1024)
+		if err := globalPk.ReadDump(pkReader); err != nil {
+			return fmt.Errorf("failed to read proving key: %w", err)
+		}
+		globalPkInitialized = true
+		fmt.Printf("Reading proving key took %s\n", time.Since(start))
+	}
+	return nil
+}
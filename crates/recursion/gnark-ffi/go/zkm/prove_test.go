@@ -0,0 +1,119 @@
+package zkm
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/frontend"
+)
+
+func TestProvePlonk(t *testing.T) {
+	dataDir := newTestDevDataDir(t)
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	proof, err := ProvePlonk(dataDir, filepath.Join(dataDir, plonkWitnessPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proof.EncodedProof == "" || proof.RawProof == "" {
+		t.Fatalf("expected an encoded and a raw proof, got %+v", proof)
+	}
+	if len(proof.PublicInputs) != 2 || proof.PublicInputs[0] != "3" || proof.PublicInputs[1] != "15" {
+		t.Fatalf("unexpected public inputs: %v", proof.PublicInputs)
+	}
+
+	if err := VerifyPlonk(dataDir, proof.RawProof, proof.PublicInputs[0], proof.PublicInputs[1]); err != nil {
+		t.Fatalf("failed to verify the returned proof: %v", err)
+	}
+}
+
+func TestProvePlonkMissingKeys(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	if _, err := ProvePlonk(dataDir, filepath.Join(dataDir, plonkWitnessPath)); err == nil {
+		t.Fatal("expected an error for a data dir without a plonk build")
+	}
+}
+
+func TestProveGroth16ContextCancelled(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	if err := BuildGroth16(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	proof, err := ProveGroth16Context(ctx, dataDir, filepath.Join(dataDir, groth16WitnessPath))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+	if proof.EncodedProof != "" || proof.RawProof != "" || proof.PublicInputs != nil {
+		t.Fatalf("expected no proof, got %+v", proof)
+	}
+}
+
+func TestProveGroth16ValidatesWitness(t *testing.T) {
+	dataDir := newTestDataDir(t)
+	if err := BuildGroth16(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The vkey hash is the BN254 scalar field modulus, which json.Unmarshal alone would accept.
+	witness := strings.Replace(testWitness, `"vkey_hash": "3"`, `"vkey_hash": "`+ecc.BN254.ScalarField().String()+`"`, 1)
+	witnessPath := filepath.Join(t.TempDir(), "witness.json")
+	if err := os.WriteFile(witnessPath, []byte(witness), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ProveGroth16Context(context.Background(), dataDir, witnessPath)
+	if err == nil || !strings.Contains(err.Error(), "invalid vkey_hash") {
+		t.Fatalf("expected the witness to fail validation, got: %v", err)
+	}
+}
+
+func TestAssertPublicConsistency(t *testing.T) {
+	witnessInput := WitnessInput{VkeyHash: "3", CommittedValuesDigest: "15"}
+	assignment := NewCircuit(witnessInput)
+	fullWitness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err := fullWitness.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := AssertPublicConsistency(witnessInput, publicWitness); err != nil {
+		t.Fatal(err)
+	}
+
+	wrong := witnessInput
+	wrong.VkeyHash = "4"
+	err = AssertPublicConsistency(wrong, publicWitness)
+	if err == nil || !strings.Contains(err.Error(), "vkey hash") {
+		t.Fatalf("expected a vkey hash mismatch, got: %v", err)
+	}
+
+	// A digest above the modulus is reduced by the solver and no longer matches the claim.
+	nonCanonical := witnessInput
+	nonCanonical.CommittedValuesDigest = new(big.Int).Add(ecc.BN254.ScalarField(), big.NewInt(15)).String()
+	assignment = NewCircuit(nonCanonical)
+	fullWitness, err = frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicWitness, err = fullWitness.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = AssertPublicConsistency(nonCanonical, publicWitness)
+	if err == nil || !strings.Contains(err.Error(), "committed values digest") {
+		t.Fatalf("expected a committed values digest mismatch, got: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package zkm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	"github.com/consensys/gnark-crypto/kzg"
+	"github.com/consensys/gnark/constraint"
+	"github.com/ProjectZKM/zkm-recursion-gnark/zkm/trusted_setup"
+)
+
+// ErrSRSUnpinned is returned by BuildPlonkWithConfig with RequirePinnedSRS set when the SRS has to
+// be downloaded but no digest is pinned to check it against.
+var ErrSRSUnpinned = errors.New("no pinned srs digest")
+
+// srsDigest returns the digest the SRS must match: config.SRSSHA256 if set, otherwise
+// trusted_setup.AztecIgnitionSrsSHA256. It is empty when neither is pinned.
+func (config BuildConfig) srsDigest() string {
+	if config.SRSSHA256 != "" {
+		return config.SRSSHA256
+	}
+	return trusted_setup.AztecIgnitionSrsSHA256
+}
+
+// pinnedSRSDigest is srsDigest for an SRS about to be downloaded. When no digest is pinned, the
+// download is trusted once its contributions verify, unless config.RequirePinnedSRS fails closed.
+func pinnedSRSDigest(config BuildConfig) (string, error) {
+	pinned := config.srsDigest()
+	if pinned == "" && config.RequirePinnedSRS {
+		return "", fmt.Errorf("%w: set BuildConfig.SRSSHA256 to the sha256 of the aztec ignition srs", ErrSRSUnpinned)
+	}
+	return pinned, nil
+}
+
+// checkSRSDownload checks the whole ceremony at srsFileName, freshly downloaded or left behind by
+// an earlier build, against pinned, falling back to the digest recorded next to it. Without
+// either, the download is trusted with a warning that reports its digest.
+func checkSRSDownload(srsFileName string, digestFileName string, pinned string) error {
+	verified, err := verifySRSFile(srsFileName, digestFileName, pinned)
+	if err != nil || verified != "" {
+		return err
+	}
+
+	digest, err := trusted_setup.SRSDigest(srsFileName)
+	if err != nil {
+		return fmt.Errorf("failed to hash srs: %w", err)
+	}
+	fmt.Printf("WARNING: trusting the unverified aztec ignition srs download with sha256 %s; pin it with BuildConfig.SRSSHA256\n", digest)
+	return nil
+}
+
+// cacheSRSPower reads the whole ceremony at srsFileName, truncates it to a 2^power domain and
+// caches the result at powerFileName, with its digest recorded at powerDigestFileName so later
+// builds can detect corruption of the cached file. The whole ceremony and its digest are then
+// deleted. It returns the truncated SRS and its digest.
+func cacheSRSPower(srsFileName string, digestFileName string, power int, powerFileName string, powerDigestFileName string) (kzg.SRS, string, error) {
+	srsFile, err := os.Open(srsFileName)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open srs file: %w", err)
+	}
+	srs := kzg.NewSRS(ecc.BN254)
+	_, err = srs.ReadFrom(srsFile)
+	srsFile.Close()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read srs: %w", err)
+	}
+	truncateSRS(srs, power)
+
+	tmpFileName := powerFileName + ".part"
+	tmpFile, err := os.Create(tmpFileName)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create srs file: %w", err)
+	}
+	srsHash := sha256.New()
+	if _, err := srs.WriteTo(io.MultiWriter(tmpFile, srsHash)); err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFileName)
+		return nil, "", fmt.Errorf("failed to write srs: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmpFileName)
+		return nil, "", fmt.Errorf("failed to write srs: %w", err)
+	}
+	digest := hex.EncodeToString(srsHash.Sum(nil))
+	if err := os.WriteFile(powerDigestFileName, []byte(digest), 0644); err != nil {
+		os.Remove(tmpFileName)
+		return nil, "", fmt.Errorf("failed to write srs digest: %w", err)
+	}
+	if err := os.Rename(tmpFileName, powerFileName); err != nil {
+		return nil, "", fmt.Errorf("failed to move srs into place: %w", err)
+	}
+
+	os.Remove(srsFileName)
+	os.Remove(digestFileName)
+	return srs, digest, nil
+}
+
+// verifySRSFile checks the SRS against the pinned digest, falling back to the digest recorded at
+// download time, and returns the digest it checked, if any. On mismatch the cached SRS is deleted
+// so that the next build downloads it again.
+func verifySRSFile(srsFileName string, digestFileName string, pinned string) (string, error) {
+	expected := pinned
+	if expected == "" && digestFileName != "" {
+		data, err := os.ReadFile(digestFileName)
+		if err != nil && !os.IsNotExist(err) {
+			return "", fmt.Errorf("failed to read srs digest: %w", err)
+		}
+		expected = strings.TrimSpace(string(data))
+	}
+	if expected == "" {
+		return "", nil
+	}
+
+	if err := trusted_setup.VerifySRS(srsFileName, expected); err != nil {
+		os.Remove(srsFileName)
+		if digestFileName != "" {
+			os.Remove(digestFileName)
+		}
+		return "", fmt.Errorf("%w; deleted the cached srs, re-run the build to download it again", err)
+	}
+	return strings.ToLower(strings.TrimPrefix(expected, "0x")), nil
+}
+
+// verifyCachedSRS checks an SRS cached by cacheSRSPower: with verifySRSFile against the digest
+// recorded next to it when full is set, and otherwise with the much cheaper
+// trusted_setup.VerifySRSQuick. It returns the digest verified, which the quick check leaves
+// empty. A corrupt SRS is deleted so that the next build caches it again.
+func verifyCachedSRS(srsFileName string, digestFileName string, full bool) (string, error) {
+	if full {
+		return verifySRSFile(srsFileName, digestFileName, "")
+	}
+	if err := trusted_setup.VerifySRSQuick(srsFileName); err != nil {
+		os.Remove(srsFileName)
+		os.Remove(digestFileName)
+		return "", fmt.Errorf("%w; deleted the cached srs, re-run the build to download it again", err)
+	}
+	return "", nil
+}
+
+// aztecIgnitionMaxSRSPower is the largest srsPower the Aztec ignition SRS supports: its
+// 100.8M G1 points cover 2^26+3 points but not 2^27+3.
+const aztecIgnitionMaxSRSPower = 26
+
+// srsPower returns the log2 of the domain a PlonK circuit with sizeSystem constraints and public
+// variables is set up over, as computed by trusted_setup.ToLagrange. The setup needs an SRS of
+// 2^srsPower+3 G1 points.
+func srsPower(sizeSystem int) (int, error) {
+	power := bits.Len(uint(sizeSystem))
+	if power > aztecIgnitionMaxSRSPower {
+		return 0, fmt.Errorf("circuit of size %d needs a 2^%d srs, the aztec ignition srs supports at most 2^%d", sizeSystem, power, aztecIgnitionMaxSRSPower)
+	}
+	return power, nil
+}
+
+// truncateSRS drops the G1 points of srs that a setup over a 2^power domain does not use, so
+// that a small circuit does not hold the whole ceremony in memory.
+func truncateSRS(srs kzg.SRS, power int) {
+	if srs, ok := srs.(*kzg_bn254.SRS); ok {
+		if n := 1<<power + 3; len(srs.Pk.G1) > n {
+			srs.Pk.G1 = srs.Pk.G1[:n:n]
+		}
+	}
+}
+
+// lagrangeFingerprint identifies the circuit shape a Lagrange SRS was computed for. Its size
+// follows the number of constraints and public variables, so a Lagrange SRS cached for another
+// circuit yields a wrong proving key.
+func lagrangeFingerprint(cs constraint.ConstraintSystem) string {
+	return fmt.Sprintf("field=%s constraints=%d public=%d", cs.Field(), cs.GetNbConstraints(), cs.GetNbPublicVariables())
+}
+
+// loadOrComputeLagrange reads the cached Lagrange SRS if the fingerprint recorded next to it
+// matches cs. Otherwise it recomputes the Lagrange SRS from srs and caches it along with the
+// fingerprint.
+func loadOrComputeLagrange(cs constraint.ConstraintSystem, srs kzg.SRS, lagrangeFileName string, fingerprintFileName string) (kzg.SRS, error) {
+	fingerprint := lagrangeFingerprint(cs)
+
+	recorded, err := os.ReadFile(fingerprintFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read srs lagrange fingerprint: %w", err)
+	}
+	if strings.TrimSpace(string(recorded)) == fingerprint {
+		lagrangeFile, err := os.Open(lagrangeFileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open srs lagrange file: %w", err)
+		}
+		defer lagrangeFile.Close()
+		srsLagrange := kzg.NewSRS(ecc.BN254)
+		if _, err := srsLagrange.ReadFrom(lagrangeFile); err != nil {
+			return nil, fmt.Errorf("failed to read srs lagrange: %w", err)
+		}
+		return srsLagrange, nil
+	}
+
+	srsLagrange := trusted_setup.ToLagrange(cs, srs)
+	lagrangeFile, err := os.Create(lagrangeFileName)
+	if err != nil {
+		return nil, fmt.Errorf("error creating srs lagrange file: %w", err)
+	}
+	defer lagrangeFile.Close()
+	if _, err := srsLagrange.WriteTo(lagrangeFile); err != nil {
+		return nil, fmt.Errorf("failed to write srs lagrange: %w", err)
+	}
+	if err := os.WriteFile(fingerprintFileName, []byte(fingerprint), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write srs lagrange fingerprint: %w", err)
+	}
+	return srsLagrange, nil
+}
@@ -0,0 +1,252 @@
+package zkm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+	"github.com/ProjectZKM/zkm-recursion-gnark/zkm/trusted_setup"
+)
+
+func TestVerifySRSFileDeletesCorruptCache(t *testing.T) {
+	dataDir := t.TempDir()
+	srsFileName := filepath.Join(dataDir, srsFile)
+	digestFileName := filepath.Join(dataDir, srsDigestFile)
+
+	contents := []byte("cached srs contents")
+	if err := os.WriteFile(srsFileName, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(contents)
+	if err := os.WriteFile(digestFileName, []byte(hex.EncodeToString(digest[:])), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifySRSFile(srsFileName, digestFileName, ""); err != nil {
+		t.Fatalf("expected untouched srs to verify: %v", err)
+	}
+
+	if err := os.WriteFile(srsFileName, []byte("cached srs c0ntents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := verifySRSFile(srsFileName, digestFileName, "")
+	if !errors.Is(err, trusted_setup.ErrSRSDigestMismatch) {
+		t.Fatalf("expected ErrSRSDigestMismatch, got: %v", err)
+	}
+	if _, err := os.Stat(srsFileName); !os.IsNotExist(err) {
+		t.Fatalf("expected corrupt srs to be deleted, stat returned: %v", err)
+	}
+}
+
+func TestCheckSRSDownloadPinned(t *testing.T) {
+	dataDir := t.TempDir()
+	srsFileName := filepath.Join(dataDir, srsFile)
+	digestFileName := filepath.Join(dataDir, srsDigestFile)
+	contents := []byte("downloaded srs contents")
+	if err := os.WriteFile(srsFileName, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(contents)
+	if err := checkSRSDownload(srsFileName, digestFileName, hex.EncodeToString(digest[:])); err != nil {
+		t.Fatalf("expected the pinned srs to verify: %v", err)
+	}
+
+	err := checkSRSDownload(srsFileName, digestFileName, strings.Repeat("0", 64))
+	if !errors.Is(err, trusted_setup.ErrSRSDigestMismatch) {
+		t.Fatalf("expected ErrSRSDigestMismatch, got: %v", err)
+	}
+	if _, err := os.Stat(srsFileName); !os.IsNotExist(err) {
+		t.Fatalf("expected the mismatched download to be deleted, stat returned: %v", err)
+	}
+}
+
+func TestCacheSRSPower(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestSRS(t, dataDir)
+	srsFileName := filepath.Join(dataDir, srsFile)
+	powerFileName := filepath.Join(dataDir, fmt.Sprintf(srsPowerFile, 4))
+	powerDigestFileName := filepath.Join(dataDir, fmt.Sprintf(srsPowerDigestFile, 4))
+
+	srs, digest, err := cacheSRSPower(srsFileName, filepath.Join(dataDir, srsDigestFile), 4, powerFileName, powerDigestFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srs.(*kzg_bn254.SRS).Pk.G1); n != 1<<4+3 {
+		t.Fatalf("expected %d points, got %d", 1<<4+3, n)
+	}
+	if _, err := os.Stat(srsFileName); !os.IsNotExist(err) {
+		t.Fatalf("expected the whole srs to be deleted, stat returned: %v", err)
+	}
+
+	cached, err := os.Open(powerFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cached.Close()
+	var cachedSRS kzg_bn254.SRS
+	if _, err := cachedSRS.ReadFrom(cached); err != nil {
+		t.Fatal(err)
+	}
+	if len(cachedSRS.Pk.G1) != 1<<4+3 {
+		t.Fatalf("expected the cached srs to hold %d points, got %d", 1<<4+3, len(cachedSRS.Pk.G1))
+	}
+	verified, err := verifyCachedSRS(powerFileName, powerDigestFileName, true)
+	if err != nil {
+		t.Fatalf("expected the cached srs to match its recorded digest: %v", err)
+	}
+	if verified != digest {
+		t.Fatalf("expected the recorded digest %s, got %q", digest, verified)
+	}
+}
+
+func TestVerifyCachedSRSQuick(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestSRS(t, dataDir)
+	srsFileName := filepath.Join(dataDir, srsFile)
+	digestFileName := filepath.Join(dataDir, srsDigestFile)
+	if _, err := verifyCachedSRS(srsFileName, digestFileName, false); err != nil {
+		t.Fatalf("expected the cached srs to verify: %v", err)
+	}
+
+	info, err := os.Stat(srsFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(srsFileName, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	_, err = verifyCachedSRS(srsFileName, digestFileName, false)
+	if !errors.Is(err, trusted_setup.ErrSRSCorrupt) {
+		t.Fatalf("expected ErrSRSCorrupt, got: %v", err)
+	}
+	if _, err := os.Stat(srsFileName); !os.IsNotExist(err) {
+		t.Fatalf("expected corrupt srs to be deleted, stat returned: %v", err)
+	}
+}
+
+// withExtraConstraints returns testConstraints with n extra multiplications asserted equal to
+// v2, which grows the circuit without changing its public inputs.
+func withExtraConstraints(n int) string {
+	var extra strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&extra, `{"opcode": "MulV", "args": [["x%d"], ["v0"], ["v1"]]},`, i)
+		fmt.Fprintf(&extra, `{"opcode": "AssertEqV", "args": [["x%d"], ["v2"]]},`, i)
+	}
+	return strings.Replace(testConstraints, `{"opcode": "CommitVkeyHash"`, extra.String()+`{"opcode": "CommitVkeyHash"`, 1)
+}
+
+// writeTestSRS places a small canonical SRS where BuildPlonk expects the downloaded one.
+func writeTestSRS(t *testing.T, dataDir string) {
+	t.Helper()
+	srs, err := kzg_bn254.NewSRS(1<<10, big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srsFileHandle, err := os.Create(filepath.Join(dataDir, srsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srsFileHandle.Close()
+	if _, err := srs.WriteTo(srsFileHandle); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildPlonkRecomputesStaleLagrange(t *testing.T) {
+	dataDir := newTestDataDir(t)
+
+	writeTestSRS(t, dataDir)
+
+	fingerprintPath := filepath.Join(dataDir, srsLagrangeFingerprintFile)
+	lagrangePath := filepath.Join(dataDir, srsLagrangeFile)
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	first, err := os.ReadFile(fingerprintPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstLagrange, err := os.Stat(lagrangePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Same circuit: the cached Lagrange SRS is reused.
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Larger circuit: the Lagrange SRS must be recomputed for the new domain size, from an SRS
+	// truncated to that size.
+	writeTestSRS(t, dataDir)
+	if err := os.WriteFile(filepath.Join(dataDir, constraintsJsonFile), []byte(withExtraConstraints(64)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildPlonk(dataDir); err != nil {
+		t.Fatal(err)
+	}
+	second, err := os.ReadFile(fingerprintPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(first, second) {
+		t.Fatalf("expected the fingerprint to change with the circuit, got %q twice", first)
+	}
+	secondLagrange, err := os.Stat(lagrangePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secondLagrange.Size() <= firstLagrange.Size() {
+		t.Fatalf("expected a larger Lagrange SRS for the larger circuit, got %d then %d bytes", firstLagrange.Size(), secondLagrange.Size())
+	}
+}
+
+func TestSRSPower(t *testing.T) {
+	for _, extra := range []int{0, 64, 300} {
+		dataDir := newTestDataDir(t)
+		constraintsFileName := filepath.Join(dataDir, constraintsJsonFile)
+		if err := os.WriteFile(constraintsFileName, []byte(withExtraConstraints(extra)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		circuit := NewCircuit(validTestWitnessInput(t)).WithConstraints(constraintsFileName)
+		cs, err := LoadOrCompilePlonk(dataDir, &circuit)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size := cs.GetNbConstraints() + cs.GetNbPublicVariables()
+		power, err := srsPower(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if 1<<power <= size || 1<<(power-1) > size {
+			t.Fatalf("%d extra constraints: power %d does not fit a circuit of size %d", extra, power, size)
+		}
+	}
+
+	if _, err := srsPower(1 << aztecIgnitionMaxSRSPower); err == nil || !strings.Contains(err.Error(), "at most") {
+		t.Fatalf("expected an error for a circuit beyond the aztec ignition srs, got: %v", err)
+	}
+}
+
+func TestTruncateSRS(t *testing.T) {
+	srs, err := kzg_bn254.NewSRS(1<<10, big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncateSRS(srs, 4)
+	if len(srs.Pk.G1) != 1<<4+3 {
+		t.Fatalf("expected %d points, got %d", 1<<4+3, len(srs.Pk.G1))
+	}
+	truncateSRS(srs, 8)
+	if len(srs.Pk.G1) != 1<<4+3 {
+		t.Fatalf("expected a smaller srs to be kept as is, got %d points", len(srs.Pk.G1))
+	}
+}
@@ -0,0 +1,94 @@
+package zkm
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/consensys/gnark/constraint"
+)
+
+// LogR1CSStats makes the Groth16 build print the R1CSStats of the compiled circuit.
+var LogR1CSStats = false
+
+// Stats summarizes the size of a compiled constraint system.
+type Stats struct {
+	NbCoefficients int
+	NbConstraints  int
+	// TotalTerms is the number of terms over the L, R and O linear expressions of every
+	// constraint. It is only computed for R1CS systems and is zero otherwise.
+	TotalTerms int
+	NumVars    int
+	// CoefficientBytes is the size of the coefficient table, one field element per coefficient.
+	CoefficientBytes int
+	// TermBytes is the size of the terms when stored as a (coefficient id, wire id) uint32 pair.
+	TermBytes int
+}
+
+// R1CSStats computes Stats for cs. The terms of an R1CS are counted while decompressing one
+// constraint at a time, so unlike GetR1Cs it never holds more than a single constraint.
+func R1CSStats(cs constraint.ConstraintSystem) Stats {
+	internal, secret, public := cs.GetNbVariables()
+	stats := Stats{
+		NbCoefficients: cs.GetNbCoefficients(),
+		NbConstraints:  cs.GetNbConstraints(),
+		NumVars:        internal + secret + public,
+	}
+	if r1cs, ok := cs.(constraint.R1CS); ok {
+		it := r1cs.GetR1CIterator()
+		for row := it.Next(); row != nil; row = it.Next() {
+			stats.TotalTerms += len(row.L) + len(row.R) + len(row.O)
+		}
+	}
+	frBytes := (cs.Field().BitLen() + 7) / 8
+	stats.CoefficientBytes = stats.NbCoefficients * frBytes
+	stats.TermBytes = stats.TotalTerms * 8
+	return stats
+}
+
+// countTermsShardSize is the smallest number of rows CountTerms hands to a goroutine.
+const countTermsShardSize = 1 << 14
+
+// CountTerms returns the number of terms over the L, R and O linear expressions of rows, such as
+// those returned by GetR1Cs. Large inputs are split into shards that are summed concurrently.
+func CountTerms(rows []constraint.R1C) int {
+	nbShards := min(runtime.GOMAXPROCS(0), (len(rows)+countTermsShardSize-1)/countTermsShardSize)
+	if nbShards <= 1 {
+		return countTerms(rows)
+	}
+
+	partials := make([]int, nbShards)
+	shardSize := (len(rows) + nbShards - 1) / nbShards
+	var wg sync.WaitGroup
+	for i := range partials {
+		start := i * shardSize
+		end := min(start+shardSize, len(rows))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			partials[i] = countTerms(rows[start:end])
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, partial := range partials {
+		total += partial
+	}
+	return total
+}
+
+func countTerms(rows []constraint.R1C) int {
+	total := 0
+	for _, row := range rows {
+		total += len(row.L) + len(row.R) + len(row.O)
+	}
+	return total
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf(
+		"constraints=%d coefficients=%d terms=%d vars=%d coefficient_bytes=%d term_bytes=%d",
+		s.NbConstraints, s.NbCoefficients, s.TotalTerms, s.NumVars, s.CoefficientBytes, s.TermBytes,
+	)
+}
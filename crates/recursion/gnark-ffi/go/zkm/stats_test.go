@@ -0,0 +1,91 @@
+package zkm
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+)
+
+// compileTestR1CS compiles the Groth16 circuit of the test data dir.
+func compileTestR1CS(t testing.TB) constraint.ConstraintSystem {
+	dataDir := newTestDataDir(t)
+	t.Setenv("CONSTRAINTS_JSON", filepath.Join(dataDir, constraintsJsonFile))
+
+	var witnessInput WitnessInput
+	if err := json.Unmarshal([]byte(testWitness), &witnessInput); err != nil {
+		t.Fatal(err)
+	}
+	circuit := NewCircuit(witnessInput).WithGroth16()
+	cs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cs
+}
+
+func TestR1CSStatsTotalTerms(t *testing.T) {
+	cs := compileTestR1CS(t)
+
+	expected := 0
+	for _, row := range cs.(constraint.R1CS).GetR1Cs() {
+		expected += len(row.L) + len(row.R) + len(row.O)
+	}
+
+	stats := R1CSStats(cs)
+	if stats.TotalTerms != expected {
+		t.Fatalf("expected %d terms, got %d", expected, stats.TotalTerms)
+	}
+	if stats.NbConstraints != cs.GetNbConstraints() {
+		t.Fatalf("expected %d constraints, got %d", cs.GetNbConstraints(), stats.NbConstraints)
+	}
+	if stats.TermBytes != 8*expected {
+		t.Fatalf("expected %d term bytes, got %d", 8*expected, stats.TermBytes)
+	}
+	if stats.CoefficientBytes != 32*stats.NbCoefficients {
+		t.Fatalf("expected %d coefficient bytes, got %d", 32*stats.NbCoefficients, stats.CoefficientBytes)
+	}
+}
+
+func TestCountTerms(t *testing.T) {
+	if n := CountTerms(nil); n != 0 {
+		t.Fatalf("expected 0 terms for no rows, got %d", n)
+	}
+
+	for _, nbRows := range []int{1, countTermsShardSize - 1, 5*countTermsShardSize + 3} {
+		rows := make([]constraint.R1C, nbRows)
+		expected := 0
+		for i := range rows {
+			rows[i] = constraint.R1C{
+				L: make(constraint.LinearExpression, i%3),
+				R: make(constraint.LinearExpression, i%5),
+				O: make(constraint.LinearExpression, i%7),
+			}
+			expected += i%3 + i%5 + i%7
+		}
+		if n := CountTerms(rows); n != expected {
+			t.Fatalf("%d rows: expected %d terms, got %d", nbRows, expected, n)
+		}
+	}
+}
+
+func BenchmarkR1CSStats(b *testing.B) {
+	cs := compileTestR1CS(b)
+
+	b.Run("iterator", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			R1CSStats(cs)
+		}
+	})
+	b.Run("materialized", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			CountTerms(cs.(constraint.R1CS).GetR1Cs())
+		}
+	})
+}
@@ -12,8 +12,8 @@ type TestPoseidon2KoalaBearCircuit struct {
 }
 
 func (circuit *TestPoseidon2KoalaBearCircuit) Define(api frontend.API) error {
-	poseidon2KoalaBearChip := poseidon2.NewKoalaBearChip(api)
 	fieldApi := koalabear.NewChip(api)
+	poseidon2KoalaBearChip := poseidon2.NewKoalaBearChip(api, fieldApi)
 
 	zero := koalabear.NewF("0")
 	input := [poseidon2.KOALABEAR_WIDTH]koalabear.Variable{}
@@ -0,0 +1,328 @@
+package trusted_setup
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/consensys/gnark-ignition-verifier/ignition"
+)
+
+// DownloadConfig holds the optional settings of DownloadAndSaveAztecIgnitionSrsWithConfig. The
+// zero value matches DownloadAndSaveAztecIgnitionSrsContext.
+type DownloadConfig struct {
+	// Progress, if set, is called from the download loop as each ceremony file is received, with
+	// the bytes of that file received so far and its total size, or -1 if the server did not
+	// report one.
+	Progress func(downloaded, total int64)
+	// HTTPClient, if set, issues the download requests, e.g. to go through a proxy or to trust a
+	// mirror's certificate. A nil client uses defaultHTTPClient.
+	HTTPClient *http.Client
+	// BaseURL, if set, replaces AztecIgnitionBaseURL, e.g. with an internal mirror of the
+	// ceremony. It must be an https URL unless AllowHTTP is set.
+	BaseURL   string
+	AllowHTTP bool
+	// MaxRetries is the number of times a request that failed with a network error or a 5xx
+	// response is retried, with exponential backoff, before giving up. Zero uses
+	// defaultMaxRetries; a negative value disables retries.
+	MaxRetries int
+}
+
+// defaultMaxRetries is the number of retries used when DownloadConfig.MaxRetries is zero.
+const defaultMaxRetries = 3
+
+// retryBaseDelay is the wait before the first retry of a failed request; it doubles on each
+// subsequent retry.
+var retryBaseDelay = time.Second
+
+// maxRetries returns the number of retries of a failed request.
+func (c DownloadConfig) maxRetries() int {
+	if c.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	return max(c.MaxRetries, 0)
+}
+
+// retryableError marks a download failure as transient, e.g. a dropped connection or a 5xx
+// response, as opposed to a client error that would fail again.
+type retryableError struct {
+	err error
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// AztecIgnitionBaseURL is the default host of the Aztec ignition ceremony files.
+const AztecIgnitionBaseURL = "https://aztec-ignition.s3.amazonaws.com/"
+
+// baseURL returns the validated base URL of the ceremony files.
+func (c DownloadConfig) baseURL() (string, error) {
+	if c.BaseURL == "" {
+		return AztecIgnitionBaseURL, nil
+	}
+	u, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid srs base url: %w", err)
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && c.AllowHTTP:
+	case u.Scheme == "http":
+		return "", fmt.Errorf("srs base url %s is not https; set AllowHTTP to use it", c.BaseURL)
+	default:
+		return "", fmt.Errorf("srs base url %s must use https", c.BaseURL)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("srs base url %s has no host", c.BaseURL)
+	}
+	return c.BaseURL, nil
+}
+
+// defaultHTTPClient is the client used without DownloadConfig.HTTPClient. Its timeouts bound
+// connecting and waiting for a response, but not the transfer of a large transcript.
+var defaultHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// httpClient returns the client to download with.
+func (c DownloadConfig) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return defaultHTTPClient
+}
+
+// fetchCeremonyFile downloads a ceremony file into the ignition cache directory, so that the
+// ignition package reads it from disk instead of issuing its own (non-cancellable) request.
+func fetchCeremonyFile(ctx context.Context, config ignition.Config, file string, download DownloadConfig) error {
+	cachePath := filepath.Join(config.CacheDir, config.Ceremony, file)
+	if _, err := os.Stat(cachePath); err == nil {
+		return nil
+	}
+
+	ceremonyURL, err := url.JoinPath(config.BaseURL, config.Ceremony)
+	if err != nil {
+		return err
+	}
+	fileURL, err := url.JoinPath(ceremonyURL, file)
+	if err != nil {
+		return err
+	}
+
+	return downloadFile(ctx, fileURL, cachePath, download)
+}
+
+// fetchContribution downloads all the transcripts of a participant into the ignition cache.
+func fetchContribution(ctx context.Context, config ignition.Config, participant ignition.Participant, download DownloadConfig) error {
+	addr := strings.ToLower(participant.Address)
+
+	// The total number of transcripts is stored in the header of each transcript.
+	totalTranscripts := 1
+	for i := 0; i < totalTranscripts; i++ {
+		file := fmt.Sprintf("%03d_%s/transcript%02d.dat", participant.Position, addr, i)
+		if err := fetchCeremonyFile(ctx, config, file, download); err != nil {
+			return err
+		}
+
+		if i == 0 {
+			f, err := os.Open(filepath.Join(config.CacheDir, config.Ceremony, file))
+			if err != nil {
+				return err
+			}
+			var header [8]byte
+			_, err = io.ReadFull(f, header[:])
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("when reading transcript header: %w", err)
+			}
+			totalTranscripts = int(binary.BigEndian.Uint32(header[4:8]))
+		}
+	}
+
+	return nil
+}
+
+// downloadFile streams the content at url into path. The content is first written to
+// path+".part", with the expected length recorded in a path+".part.length" sidecar; an
+// interrupted download is resumed with a Range request on the next attempt, and the part file is
+// only renamed to path once the full length is present. Transient failures are retried up to
+// config.maxRetries() times.
+func downloadFile(ctx context.Context, url string, path string, config DownloadConfig) error {
+	delay := retryBaseDelay
+	for retry := 0; ; retry++ {
+		err := downloadFileOnce(ctx, url, path, config)
+		var retryable *retryableError
+		if err == nil || !errors.As(err, &retryable) || retry >= config.maxRetries() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// downloadFileOnce makes a single attempt of downloadFile.
+func downloadFileOnce(ctx context.Context, url string, path string, config DownloadConfig) error {
+	partPath := path + ".part"
+	lengthPath := partPath + ".length"
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	// Resume from the current offset if a previous attempt left a part file behind.
+	var offset int64
+	expectedLength, haveLength := readExpectedLength(lengthPath)
+	if info, err := os.Stat(partPath); err == nil && haveLength {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := config.httpClient().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// An untrusted certificate will not be trusted on the next attempt either.
+		var certErr *tls.CertificateVerificationError
+		if errors.As(err, &certErr) {
+			return err
+		}
+		return &retryableError{err}
+	}
+	defer resp.Body.Close()
+
+	var f *os.File
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		f, err = os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0644)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// The part file already holds the whole content.
+	case resp.StatusCode == http.StatusOK:
+		// Either a fresh download or a server that ignored the Range header: start over.
+		haveLength = resp.ContentLength >= 0
+		expectedLength = resp.ContentLength
+		if haveLength {
+			err = os.WriteFile(lengthPath, []byte(strconv.FormatInt(expectedLength, 10)), 0644)
+		} else {
+			err = os.Remove(lengthPath)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err == nil {
+			f, err = os.Create(partPath)
+		}
+	default:
+		err := fmt.Errorf("unexpected status downloading %s: %s", url, resp.Status)
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return &retryableError{err}
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if f != nil {
+		var w io.Writer = f
+		if config.Progress != nil {
+			progress := &progressWriter{w: f, total: -1, progress: config.Progress}
+			if haveLength {
+				progress.total = expectedLength
+			}
+			if resp.StatusCode == http.StatusPartialContent {
+				progress.downloaded = offset
+			}
+			w = progress
+		}
+		_, err = io.Copy(w, resp.Body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return &retryableError{err}
+		}
+	}
+
+	info, err := os.Stat(partPath)
+	if err != nil {
+		return err
+	}
+	if haveLength && info.Size() != expectedLength {
+		return &retryableError{fmt.Errorf("incomplete download of %s: have %d of %d bytes", url, info.Size(), expectedLength)}
+	}
+
+	if err := os.Rename(partPath, path); err != nil {
+		return err
+	}
+	os.Remove(lengthPath)
+
+	return nil
+}
+
+// progressWriter reports the running byte count of a download to its progress callback.
+type progressWriter struct {
+	w          io.Writer
+	downloaded int64
+	total      int64
+	progress   func(downloaded, total int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.downloaded += int64(n)
+	p.progress(p.downloaded, p.total)
+	return n, err
+}
+
+// readExpectedLength reads the content length recorded for an in-progress download.
+func readExpectedLength(lengthPath string) (int64, bool) {
+	data, err := os.ReadFile(lengthPath)
+	if err != nil {
+		return 0, false
+	}
+	length, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return length, true
+}
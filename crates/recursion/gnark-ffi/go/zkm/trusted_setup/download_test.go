@@ -0,0 +1,294 @@
+package trusted_setup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownloadFileCancelled(t *testing.T) {
+	started := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1048576")
+		w.WriteHeader(http.StatusOK)
+		chunk := make([]byte, 1024)
+		for i := 0; i < 1024; i++ {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			if i == 0 {
+				close(started)
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	path := filepath.Join(t.TempDir(), "srs.bin")
+	err := downloadFile(ctx, server.URL, path, DownloadConfig{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no file at the final path, stat returned: %v", err)
+	}
+}
+
+func TestDownloadFileResumesPartial(t *testing.T) {
+	content := make([]byte, 64*1024)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "srs.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	// Simulate an interrupted download that stopped half way.
+	path := filepath.Join(t.TempDir(), "srs.bin")
+	half := len(content) / 2
+	if err := os.WriteFile(path+".part", content[:half], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".part.length", []byte(strconv.Itoa(len(content))), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := downloadFile(context.Background(), server.URL, path, DownloadConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ranges) != 1 || ranges[0] != fmt.Sprintf("bytes=%d-", half) {
+		t.Fatalf("expected a single ranged request from offset %d, got %q", half, ranges)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatal("resumed download does not match the served content")
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Fatalf("expected part file to be promoted, stat returned: %v", err)
+	}
+}
+
+// shortRetryDelay shrinks the backoff between retries for the rest of the test.
+func shortRetryDelay(t *testing.T) {
+	t.Helper()
+	delay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = delay })
+}
+
+func TestDownloadFileRetries(t *testing.T) {
+	shortRetryDelay(t)
+	content := []byte("srs contents after a flaky start")
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= 2 {
+			http.Error(w, "try again", http.StatusServiceUnavailable)
+			return
+		}
+		http.ServeContent(w, r, "srs.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "srs.bin")
+	if err := downloadFile(context.Background(), server.URL, path, DownloadConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Fatalf("expected 3 requests, got %d", requests)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatal("downloaded content does not match the served content")
+	}
+
+	requests = 0
+	err = downloadFile(context.Background(), server.URL, filepath.Join(t.TempDir(), "srs.bin"), DownloadConfig{MaxRetries: 1})
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("expected the 503 to be returned once the retries are exhausted, got: %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("expected 2 requests with MaxRetries 1, got %d", requests)
+	}
+}
+
+func TestDownloadFileNoRetryOnClientError(t *testing.T) {
+	shortRetryDelay(t)
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	err := downloadFile(context.Background(), server.URL, filepath.Join(t.TempDir(), "srs.bin"), DownloadConfig{})
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("expected a 404 error, got: %v", err)
+	}
+	if requests != 1 {
+		t.Fatalf("expected a single request for a 404, got %d", requests)
+	}
+}
+
+func TestDownloadFileRetryCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		http.Error(w, "try again", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	// The default one second backoff would outlive the test if cancellation were ignored.
+	err := downloadFile(ctx, server.URL, filepath.Join(t.TempDir(), "srs.bin"), DownloadConfig{})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got: %v", err)
+	}
+}
+
+func TestDownloadFileProgress(t *testing.T) {
+	content := make([]byte, 256*1024+17)
+	for i := range content {
+		content[i] = byte(i * 13)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "srs.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	var calls int
+	var downloaded, total int64
+	config := DownloadConfig{Progress: func(d, n int64) {
+		if d < downloaded {
+			t.Errorf("progress went backwards from %d to %d", downloaded, d)
+		}
+		calls++
+		downloaded, total = d, n
+	}}
+	path := filepath.Join(t.TempDir(), "srs.bin")
+	if err := downloadFile(context.Background(), server.URL, path, config); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls == 0 {
+		t.Fatal("expected the progress callback to be called")
+	}
+	if total != int64(len(content)) || downloaded != total {
+		t.Fatalf("expected a final progress of %d/%d, got %d/%d", len(content), len(content), downloaded, total)
+	}
+}
+
+// countingTransport counts the requests it forwards.
+type countingTransport struct {
+	base     http.RoundTripper
+	requests int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.requests++
+	return c.base.RoundTrip(req)
+}
+
+func TestDownloadFileHTTPClient(t *testing.T) {
+	content := []byte("mirrored srs contents")
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "srs.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	// Only the server's own client trusts its certificate.
+	path := filepath.Join(t.TempDir(), "srs.bin")
+	if err := downloadFile(context.Background(), server.URL, path, DownloadConfig{}); err == nil {
+		t.Fatal("expected the default client to reject the mirror certificate")
+	}
+
+	transport := &countingTransport{base: server.Client().Transport}
+	config := DownloadConfig{HTTPClient: &http.Client{Transport: transport}}
+	if err := downloadFile(context.Background(), server.URL, path, config); err != nil {
+		t.Fatal(err)
+	}
+	if transport.requests != 1 {
+		t.Fatalf("expected 1 request through the custom client, got %d", transport.requests)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, content) {
+		t.Fatal("downloaded content does not match the mirror")
+	}
+}
+
+// chdirTemp runs the rest of the test in a temporary directory, so that the ignition cache
+// written to ./data does not land in the source tree.
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestDownloadBaseURL(t *testing.T) {
+	chdirTemp(t)
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	srsFileName := filepath.Join(t.TempDir(), "srs.bin")
+
+	for _, baseURL := range []string{server.URL, "ftp://mirror.example/", "https://"} {
+		err := DownloadAndSaveAztecIgnitionSrsWithConfig(context.Background(), 174, srsFileName, DownloadConfig{BaseURL: baseURL})
+		if err == nil || !strings.Contains(err.Error(), "srs base url") {
+			t.Fatalf("expected %q to be rejected, got: %v", baseURL, err)
+		}
+	}
+	if len(paths) != 0 {
+		t.Fatalf("expected no request for a rejected base url, got %q", paths)
+	}
+
+	config := DownloadConfig{BaseURL: server.URL, AllowHTTP: true}
+	err := DownloadAndSaveAztecIgnitionSrsWithConfig(context.Background(), 174, srsFileName, config)
+	if err == nil || !strings.Contains(err.Error(), "when fetching manifest") {
+		t.Fatalf("expected the manifest fetch from the mirror to fail, got: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/MAIN IGNITION/manifest.json" {
+		t.Fatalf("expected the manifest to be requested from the mirror, got %q", paths)
+	}
+}
@@ -1,6 +1,8 @@
 package trusted_setup
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 
@@ -67,8 +69,27 @@ func eval(p []fr.Element, point fr.Element) fr.Element {
 }
 
 func DownloadAndSaveAztecIgnitionSrs(startIdx int, fileName string) {
+	if err := DownloadAndSaveAztecIgnitionSrsContext(context.Background(), startIdx, fileName); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// DownloadAndSaveAztecIgnitionSrsContext downloads and verifies the Aztec ignition contributions
+// starting at startIdx and writes the resulting SRS to fileName. Cancelling ctx aborts the
+// transfer and returns ctx.Err(); no partially-written SRS is left behind at fileName.
+func DownloadAndSaveAztecIgnitionSrsContext(ctx context.Context, startIdx int, fileName string) error {
+	return DownloadAndSaveAztecIgnitionSrsWithConfig(ctx, startIdx, fileName, DownloadConfig{})
+}
+
+// DownloadAndSaveAztecIgnitionSrsWithConfig is like DownloadAndSaveAztecIgnitionSrsContext, with
+// the download adjusted by download.
+func DownloadAndSaveAztecIgnitionSrsWithConfig(ctx context.Context, startIdx int, fileName string, download DownloadConfig) error {
+	baseURL, err := download.baseURL()
+	if err != nil {
+		return err
+	}
 	config := ignition.Config{
-		BaseURL:  "https://aztec-ignition.s3.amazonaws.com/",
+		BaseURL:  baseURL,
 		Ceremony: "MAIN IGNITION", // "TINY_TEST_5"
 		CacheDir: "./data",
 	}
@@ -77,39 +98,48 @@ func DownloadAndSaveAztecIgnitionSrs(startIdx int, fileName string) {
 		err := os.MkdirAll(config.CacheDir, os.ModePerm)
 
 		if err != nil {
-			log.Fatal("when creating cache dir: ", err)
-			panic(err)
+			return fmt.Errorf("when creating cache dir: %w", err)
 		}
 	}
 
 	log.Println("fetch manifest")
 
+	if err := fetchCeremonyFile(ctx, config, "manifest.json", download); err != nil {
+		return fmt.Errorf("when fetching manifest: %w", err)
+	}
 	manifest, err := ignition.NewManifest(config)
 
 	if err != nil {
-		log.Fatal("when fetching manifest: ", err)
+		return fmt.Errorf("when fetching manifest: %w", err)
+	}
+
+	getContribution := func(c *ignition.Contribution, i int) error {
+		if err := fetchContribution(ctx, config, manifest.Participants[i], download); err != nil {
+			return err
+		}
+		return c.Get(manifest.Participants[i], config)
 	}
 
 	current, next := ignition.NewContribution(manifest.NumG1Points), ignition.NewContribution(manifest.NumG1Points)
 
-	if err := current.Get(manifest.Participants[startIdx], config); err != nil {
-		log.Fatal("when fetching contribution: ", err)
+	if err := getContribution(&current, startIdx); err != nil {
+		return fmt.Errorf("when fetching contribution: %w", err)
 	}
-	if err := next.Get(manifest.Participants[startIdx+1], config); err != nil {
-		log.Fatal("when fetching contribution: ", err)
+	if err := getContribution(&next, startIdx+1); err != nil {
+		return fmt.Errorf("when fetching contribution: %w", err)
 	}
 	if !next.Follows(&current) {
-		log.Fatalf("contribution %d does not follow contribution %d", startIdx+1, startIdx)
+		return fmt.Errorf("contribution %d does not follow contribution %d", startIdx+1, startIdx)
 	}
 
 	for i := startIdx + 2; i < len(manifest.Participants); i++ {
 		log.Println("processing contribution ", i+1)
 		current, next = next, current
-		if err := next.Get(manifest.Participants[i], config); err != nil {
-			log.Fatal("when fetching contribution ", i+1, ": ", err)
+		if err := getContribution(&next, i); err != nil {
+			return fmt.Errorf("when fetching contribution %d: %w", i+1, err)
 		}
 		if !next.Follows(&current) {
-			log.Fatal("contribution ", i+1, " does not follow contribution ", i, ": ", err)
+			return fmt.Errorf("contribution %d does not follow contribution %d", i+1, i)
 		}
 	}
 
@@ -134,18 +164,27 @@ func DownloadAndSaveAztecIgnitionSrs(startIdx int, fileName string) {
 	sanityCheck(&srs)
 	log.Println("success ✅: kzg sanity check with SRS")
 
-	fSRS, err := os.Create(fileName)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Write to a part file first so an interrupted write is never mistaken for a complete SRS.
+	partFileName := fileName + ".part"
+	fSRS, err := os.Create(partFileName)
 	if err != nil {
-		log.Fatal("error creating srs file: ", err)
-		panic(err)
+		return fmt.Errorf("error creating srs file: %w", err)
 	}
-	defer fSRS.Close()
 
 	_, err = srs.WriteTo(fSRS)
+	if cerr := fSRS.Close(); err == nil {
+		err = cerr
+	}
 	if err != nil {
-		log.Fatal("error writing srs file: ", err)
-		panic(err)
+		os.Remove(partFileName)
+		return fmt.Errorf("error writing srs file: %w", err)
 	}
+
+	return os.Rename(partFileName, fileName)
 }
 
 func ToLagrange(scs constraint.ConstraintSystem, canonicalSRS kzg.SRS) kzg.SRS {
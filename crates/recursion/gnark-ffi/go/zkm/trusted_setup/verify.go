@@ -0,0 +1,124 @@
+package trusted_setup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+)
+
+// AztecIgnitionSrsSHA256 is the expected SHA256 digest of the SRS produced by
+// DownloadAndSaveAztecIgnitionSrs(174, ...), i.e. from the contributions of the 174th
+// participant on. It is left empty until pinned; until then zkm.BuildPlonkWithConfig trusts a
+// download whose contributions verify and records its digest.
+const AztecIgnitionSrsSHA256 = ""
+
+// ErrSRSDigestMismatch is returned by VerifySRS when the file does not match the expected digest.
+var ErrSRSDigestMismatch = errors.New("srs digest mismatch")
+
+// ErrSRSCorrupt is returned by VerifySRSQuick when the file is not a well formed SRS.
+var ErrSRSCorrupt = errors.New("corrupt srs")
+
+// srsQuickSamples is the number of G1 points VerifySRSQuick decodes.
+const srsQuickSamples = 16
+
+// SRSDigest returns the hex encoded SHA256 digest of the file at path.
+func SRSDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifySRS checks that the file at path has the given hex encoded SHA256 digest.
+func VerifySRS(path string, expectedSHA256 string) error {
+	actual, err := SRSDigest(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash srs: %w", err)
+	}
+	if !strings.EqualFold(actual, strings.TrimPrefix(expectedSHA256, "0x")) {
+		return fmt.Errorf("%w: %s has sha256 %s, expected %s", ErrSRSDigestMismatch, path, actual, expectedSHA256)
+	}
+	return nil
+}
+
+// VerifySRSQuick checks the BN254 SRS at path for gross corruption without reading all of it:
+// the file length must match the number of G1 points in its header, a few G1 points sampled
+// across the file must decode to points on the curve, and the verifying key must start where
+// expected. Unlike VerifySRS it does not detect a tampered but well formed SRS.
+func VerifySRSQuick(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The SRS is written by kzg_bn254.SRS.WriteTo: the G1 points of the proving key behind a
+	// big-endian uint32 count, then the verifying key.
+	var header [4]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return fmt.Errorf("%w: %s: failed to read header: %v", ErrSRSCorrupt, path, err)
+	}
+	nbPoints := int64(binary.BigEndian.Uint32(header[:]))
+	var vk kzg_bn254.VerifyingKey
+	vkSize, err := vk.WriteTo(io.Discard)
+	if err != nil {
+		return err
+	}
+	expected := int64(len(header)) + nbPoints*bn254.SizeOfG1AffineCompressed + vkSize
+	if nbPoints == 0 || info.Size() != expected {
+		return fmt.Errorf("%w: %s is %d bytes, expected %d for %d g1 points", ErrSRSCorrupt, path, info.Size(), expected, nbPoints)
+	}
+
+	pointAt := func(offset int64) ([]byte, error) {
+		buf := make([]byte, bn254.SizeOfG1AffineCompressed)
+		if _, err := f.ReadAt(buf, offset); err != nil {
+			return nil, err
+		}
+		var p bn254.G1Affine
+		if _, err := p.SetBytes(buf); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+	samples := min(nbPoints, srsQuickSamples)
+	for i := int64(0); i < samples; i++ {
+		index := nbPoints - 1
+		if samples > 1 {
+			index = i * (nbPoints - 1) / (samples - 1)
+		}
+		if _, err := pointAt(int64(len(header)) + index*bn254.SizeOfG1AffineCompressed); err != nil {
+			return fmt.Errorf("%w: %s: g1 point %d: %v", ErrSRSCorrupt, path, index, err)
+		}
+	}
+
+	// The verifying key holds the first G1 point after its two G2 points.
+	first, err := pointAt(int64(len(header)))
+	if err != nil {
+		return fmt.Errorf("%w: %s: g1 point 0: %v", ErrSRSCorrupt, path, err)
+	}
+	vkG1, err := pointAt(expected - vkSize + 2*bn254.SizeOfG2AffineCompressed)
+	if err != nil || !bytes.Equal(vkG1, first) {
+		return fmt.Errorf("%w: %s: verifying key does not match the proving key", ErrSRSCorrupt, path)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package trusted_setup
+
+import (
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc/bn254"
+	kzg_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/kzg"
+)
+
+func TestVerifySRS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "srs.bin")
+	if err := os.WriteFile(path, []byte("not really an srs, but good enough to hash"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := SRSDigest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySRS(path, digest); err != nil {
+		t.Fatalf("expected digest to match: %v", err)
+	}
+
+	// Corrupt a single byte.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0x01
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySRS(path, digest); !errors.Is(err, ErrSRSDigestMismatch) {
+		t.Fatalf("expected ErrSRSDigestMismatch, got: %v", err)
+	}
+}
+
+func TestVerifySRSQuick(t *testing.T) {
+	srs, err := kzg_bn254.NewSRS(100, big.NewInt(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "srs.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srs.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if err := VerifySRSQuick(path); err != nil {
+		t.Fatalf("expected a well formed srs to pass: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the last G1 point of the proving key.
+	pointsEnd := 4 + len(srs.Pk.G1)*bn254.SizeOfG1AffineCompressed
+	truncated := append(append([]byte{}, data[:pointsEnd-bn254.SizeOfG1AffineCompressed]...), data[pointsEnd:]...)
+	if err := os.WriteFile(path, truncated, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySRSQuick(path); !errors.Is(err, ErrSRSCorrupt) {
+		t.Fatalf("expected ErrSRSCorrupt for a missing point, got: %v", err)
+	}
+
+	// With the count fixed up, it is a well formed SRS of one point less.
+	truncated[3]--
+	if err := os.WriteFile(path, truncated, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySRSQuick(path); err != nil {
+		t.Fatalf("expected an srs with one point less to pass: %v", err)
+	}
+
+	// Corrupt the first point.
+	corrupted := append([]byte{}, data...)
+	corrupted[4+bn254.SizeOfG1AffineCompressed-1] ^= 0xff
+	if err := os.WriteFile(path, corrupted, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySRSQuick(path); !errors.Is(err, ErrSRSCorrupt) {
+		t.Fatalf("expected ErrSRSCorrupt for a corrupted point, got: %v", err)
+	}
+}
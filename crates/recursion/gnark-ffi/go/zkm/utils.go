@@ -3,6 +3,9 @@ package zkm
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
 
 	groth16 "github.com/consensys/gnark/backend/groth16"
 	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
@@ -12,17 +15,20 @@ import (
 	"github.com/ProjectZKM/zkm-recursion-gnark/zkm/koalabear"
 )
 
-func NewZKMPlonkBn254Proof(proof *plonk.Proof, witnessInput WitnessInput) Proof {
+// NewZKMPlonkBn254Proof encodes a BN254 PlonK proof. It returns an error if proof was produced
+// by a different backend or on a different curve.
+func NewZKMPlonkBn254Proof(proof *plonk.Proof, witnessInput WitnessInput, extraPublicInputs ...string) (Proof, error) {
+	// Cast plonk proof into plonk_bn254 proof so we can call MarshalSolidity.
+	p, ok := (*proof).(*plonk_bn254.Proof)
+	if !ok {
+		return Proof{}, fmt.Errorf("expected %s, got %s", typeName(&plonk_bn254.Proof{}), typeName(*proof))
+	}
+
 	var buf bytes.Buffer
-	(*proof).WriteRawTo(&buf)
+	p.WriteRawTo(&buf)
 	proofBytes := buf.Bytes()
 
-	var publicInputs [2]string
-	publicInputs[0] = witnessInput.VkeyHash
-	publicInputs[1] = witnessInput.CommittedValuesDigest
-
-	// Cast plonk proof into plonk_bn254 proof so we can call MarshalSolidity.
-	p := (*proof).(*plonk_bn254.Proof)
+	publicInputs := newPublicInputs(witnessInput, extraPublicInputs)
 
 	encodedProof := p.MarshalSolidity()
 
@@ -30,20 +36,23 @@ func NewZKMPlonkBn254Proof(proof *plonk.Proof, witnessInput WitnessInput) Proof
 		PublicInputs: publicInputs,
 		EncodedProof: hex.EncodeToString(encodedProof),
 		RawProof:     hex.EncodeToString(proofBytes),
-	}
+	}, nil
 }
 
-func NewZKMGroth16Proof(proof *groth16.Proof, witnessInput WitnessInput) Proof {
+// NewZKMGroth16Proof encodes a BN254 Groth16 proof. It returns an error if proof was produced on
+// a different curve.
+func NewZKMGroth16Proof(proof *groth16.Proof, witnessInput WitnessInput, extraPublicInputs ...string) (Proof, error) {
+	// Cast groth16 proof into groth16_bn254 proof so we can call MarshalSolidity.
+	p, ok := (*proof).(*groth16_bn254.Proof)
+	if !ok {
+		return Proof{}, fmt.Errorf("expected %s, got %s", typeName(&groth16_bn254.Proof{}), typeName(*proof))
+	}
+
 	var buf bytes.Buffer
-	(*proof).WriteRawTo(&buf)
+	p.WriteRawTo(&buf)
 	proofBytes := buf.Bytes()
 
-	var publicInputs [2]string
-	publicInputs[0] = witnessInput.VkeyHash
-	publicInputs[1] = witnessInput.CommittedValuesDigest
-
-	// Cast groth16 proof into groth16_bn254 proof so we can call MarshalSolidity.
-	p := (*proof).(*groth16_bn254.Proof)
+	publicInputs := newPublicInputs(witnessInput, extraPublicInputs)
 
 	encodedProof := p.MarshalSolidity()
 
@@ -51,7 +60,84 @@ func NewZKMGroth16Proof(proof *groth16.Proof, witnessInput WitnessInput) Proof {
 		PublicInputs: publicInputs,
 		EncodedProof: hex.EncodeToString(encodedProof),
 		RawProof:     hex.EncodeToString(proofBytes),
+	}, nil
+}
+
+// NewZKMGroth16Proofs is the batch form of NewZKMGroth16Proof. It reuses a single buffer for the
+// raw encoding of every proof and reports the index of any proof that cannot be encoded.
+func NewZKMGroth16Proofs(proofs []*groth16.Proof, inputs []WitnessInput) ([]Proof, error) {
+	if len(proofs) != len(inputs) {
+		return nil, fmt.Errorf("got %d proofs but %d witness inputs", len(proofs), len(inputs))
+	}
+
+	result := make([]Proof, len(proofs))
+	var buf bytes.Buffer
+	for i, proof := range proofs {
+		if proof == nil || *proof == nil {
+			return nil, fmt.Errorf("proof %d is nil", i)
+		}
+		p, ok := (*proof).(*groth16_bn254.Proof)
+		if !ok {
+			return nil, fmt.Errorf("proof %d: expected %s, got %s", i, typeName(&groth16_bn254.Proof{}), typeName(*proof))
+		}
+
+		buf.Reset()
+		if _, err := p.WriteRawTo(&buf); err != nil {
+			return nil, fmt.Errorf("proof %d: failed to write raw proof: %w", i, err)
+		}
+
+		result[i] = Proof{
+			PublicInputs: newPublicInputs(inputs[i], nil),
+			EncodedProof: hex.EncodeToString(p.MarshalSolidity()),
+			RawProof:     hex.EncodeToString(buf.Bytes()),
+		}
+	}
+	return result, nil
+}
+
+// typeName returns the package-qualified type of v. Unlike %T it tells the per-curve gnark
+// backends apart, which all name their proof type groth16.Proof or plonk.Proof.
+func typeName(v any) string {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return "nil"
+	}
+	prefix := ""
+	for t.Kind() == reflect.Pointer {
+		prefix += "*"
+		t = t.Elem()
 	}
+	if t.PkgPath() == "" {
+		return prefix + t.String()
+	}
+	return prefix + t.PkgPath() + "." + t.Name()
+}
+
+// newPublicInputs returns the public inputs of a Proof: the vkey hash and the committed values
+// digest, followed by any extra public inputs exposed by the circuit.
+func newPublicInputs(witnessInput WitnessInput, extraPublicInputs []string) []string {
+	publicInputs := make([]string, 0, 2+len(extraPublicInputs))
+	publicInputs = append(publicInputs, witnessInput.VkeyHash, witnessInput.CommittedValuesDigest)
+	return append(publicInputs, extraPublicInputs...)
+}
+
+// DecodeZKMGroth16Proof is the inverse of NewZKMGroth16Proof: it decodes the gnark raw proof
+// held in p.RawProof back into a BN254 Groth16 proof.
+func DecodeZKMGroth16Proof(p Proof) (*groth16_bn254.Proof, error) {
+	proofBytes, err := hex.DecodeString(p.RawProof)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode raw proof hex: %w", err)
+	}
+
+	var proof groth16_bn254.Proof
+	n, err := proof.ReadFrom(bytes.NewReader(proofBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read raw proof (%d bytes): %w", len(proofBytes), err)
+	}
+	if n != int64(len(proofBytes)) {
+		return nil, fmt.Errorf("raw proof has %d trailing bytes", int64(len(proofBytes))-n)
+	}
+	return &proof, nil
 }
 
 func NewCircuit(witnessInput WitnessInput) Circuit {
@@ -75,3 +161,51 @@ func NewCircuit(witnessInput WitnessInput) Circuit {
 		Exts:                  exts,
 	}
 }
+
+// NewCircuitChecked is NewCircuit returning an error for a felt or ext component that is not a
+// koalabear element, instead of failing later in the solver.
+func NewCircuitChecked(witnessInput WitnessInput) (Circuit, error) {
+	felts := make([]koalabear.Variable, len(witnessInput.Felts))
+	exts := make([]koalabear.ExtensionVariable, len(witnessInput.Exts))
+	for i, f := range witnessInput.Felts {
+		felt, err := koalabear.ParseF(f)
+		if err != nil {
+			return Circuit{}, fmt.Errorf("invalid felts[%d]: %w", i, err)
+		}
+		felts[i] = felt
+	}
+	for i, e := range witnessInput.Exts {
+		if len(e) != 4 {
+			return Circuit{}, fmt.Errorf("invalid exts[%d]: expected 4 components, got %d", i, len(e))
+		}
+		for j, f := range e {
+			felt, err := koalabear.ParseF(f)
+			if err != nil {
+				return Circuit{}, fmt.Errorf("invalid exts[%d][%d]: %w", i, j, err)
+			}
+			exts[i].Value[j] = felt
+		}
+	}
+
+	circuit := NewCircuit(WitnessInput{
+		Vars:                  witnessInput.Vars,
+		VkeyHash:              witnessInput.VkeyHash,
+		CommittedValuesDigest: witnessInput.CommittedValuesDigest,
+	})
+	circuit.Felts = felts
+	circuit.Exts = exts
+	return circuit, nil
+}
+
+// NewCircuitFromReader decodes a JSON WitnessInput from r, validates it and constructs its
+// Circuit.
+func NewCircuitFromReader(r io.Reader) (Circuit, WitnessInput, error) {
+	witnessInput, err := ParseWitnessInput(r)
+	if err != nil {
+		return Circuit{}, WitnessInput{}, fmt.Errorf("error deserializing witness input: %w", err)
+	}
+	if err := witnessInput.Validate(); err != nil {
+		return Circuit{}, WitnessInput{}, err
+	}
+	return NewCircuit(witnessInput), witnessInput, nil
+}
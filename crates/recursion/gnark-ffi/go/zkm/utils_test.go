@@ -0,0 +1,284 @@
+package zkm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/ProjectZKM/zkm-recursion-gnark/zkm/koalabear"
+)
+
+func TestNewCircuitFromReader(t *testing.T) {
+	witness := `{
+		"vars": ["1", "2", "3"],
+		"felts": ["4", "5"],
+		"exts": [["1", "2", "3", "4"]],
+		"vkey_hash": "6",
+		"committed_values_digest": "7"
+	}`
+
+	circuit, witnessInput, err := NewCircuitFromReader(bytes.NewReader([]byte(witness)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(circuit.Vars) != 3 || len(circuit.Felts) != 2 || len(circuit.Exts) != 1 {
+		t.Fatalf("unexpected circuit shape: %d vars, %d felts, %d exts", len(circuit.Vars), len(circuit.Felts), len(circuit.Exts))
+	}
+	if witnessInput.VkeyHash != "6" || witnessInput.CommittedValuesDigest != "7" {
+		t.Fatalf("unexpected public inputs: %q, %q", witnessInput.VkeyHash, witnessInput.CommittedValuesDigest)
+	}
+}
+
+func TestNewCircuitChecked(t *testing.T) {
+	witnessInput := WitnessInput{
+		Vars:                  []string{"1"},
+		Felts:                 []string{"4", "5"},
+		Exts:                  [][]string{{"1", "2", "3", "4"}},
+		VkeyHash:              "6",
+		CommittedValuesDigest: "7",
+	}
+	circuit, err := NewCircuitChecked(witnessInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(circuit.Vars) != 1 || len(circuit.Felts) != 2 || len(circuit.Exts) != 1 {
+		t.Fatalf("unexpected circuit shape: %d vars, %d felts, %d exts", len(circuit.Vars), len(circuit.Felts), len(circuit.Exts))
+	}
+
+	witnessInput.Exts = [][]string{{"1", "2", "not-a-number", "4"}}
+	_, err = NewCircuitChecked(witnessInput)
+	if !errors.Is(err, koalabear.ErrSyntax) || !strings.Contains(err.Error(), "exts[0][2]") {
+		t.Fatalf("expected a syntax error for exts[0][2], got: %v", err)
+	}
+}
+
+func TestNewCircuitFromReaderInvalidJSON(t *testing.T) {
+	if _, _, err := NewCircuitFromReader(bytes.NewReader([]byte(`{"vars": [`))); err == nil {
+		t.Fatal("expected an error for truncated JSON")
+	}
+}
+
+// newTestGroth16Proof compiles the test circuit on BN254 and proves it with a fresh setup.
+func newTestGroth16Proof(t testing.TB) (groth16.Proof, groth16.VerifyingKey, WitnessInput) {
+	t.Helper()
+	dataDir := newTestDataDir(t)
+	t.Setenv("CONSTRAINTS_JSON", filepath.Join(dataDir, constraintsJsonFile))
+
+	witnessInput := validTestWitnessInput(t)
+	circuit := NewCircuit(witnessInput).WithGroth16()
+	cs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &circuit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assignment := NewCircuit(witnessInput)
+	witness, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := groth16.Prove(cs, pk, witness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof, vk, witnessInput
+}
+
+func TestDecodeZKMGroth16Proof(t *testing.T) {
+	proof, _, witnessInput := newTestGroth16Proof(t)
+
+	p, err := NewZKMGroth16Proof(&proof, witnessInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeZKMGroth16Proof(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected, actual bytes.Buffer
+	if _, err := proof.WriteRawTo(&expected); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoded.WriteRawTo(&actual); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected.Bytes(), actual.Bytes()) {
+		t.Fatal("decoded proof does not match the original")
+	}
+}
+
+func TestDecodeZKMGroth16ProofTruncated(t *testing.T) {
+	proof, _, witnessInput := newTestGroth16Proof(t)
+
+	p, err := NewZKMGroth16Proof(&proof, witnessInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RawProof = p.RawProof[:len(p.RawProof)/2]
+	if _, err := DecodeZKMGroth16Proof(p); err == nil {
+		t.Fatal("expected an error for a truncated raw proof")
+	}
+}
+
+func TestNewZKMGroth16ProofPublicInputs(t *testing.T) {
+	proof, _, witnessInput := newTestGroth16Proof(t)
+
+	p, err := NewZKMGroth16Proof(&proof, witnessInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.PublicInputs) != 2 {
+		t.Fatalf("expected 2 public inputs, got %d", len(p.PublicInputs))
+	}
+	if p.PublicInputs[0] != witnessInput.VkeyHash || p.PublicInputs[1] != witnessInput.CommittedValuesDigest {
+		t.Fatalf("unexpected public inputs: %v", p.PublicInputs)
+	}
+
+	p, err = NewZKMGroth16Proof(&proof, witnessInput, "42", "43")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.PublicInputs) != 4 {
+		t.Fatalf("expected 4 public inputs, got %d", len(p.PublicInputs))
+	}
+	if p.PublicInputs[0] != witnessInput.VkeyHash || p.PublicInputs[1] != witnessInput.CommittedValuesDigest {
+		t.Fatalf("expected the first two public inputs to be unchanged, got: %v", p.PublicInputs)
+	}
+	if p.PublicInputs[2] != "42" || p.PublicInputs[3] != "43" {
+		t.Fatalf("unexpected extra public inputs: %v", p.PublicInputs[2:])
+	}
+}
+
+func TestProofMetrics(t *testing.T) {
+	proof, _, witnessInput := newTestGroth16Proof(t)
+
+	p, err := NewZKMGroth16Proof(&proof, witnessInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bytes.Buffer
+	if _, err := proof.WriteRawTo(&raw); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics := p.Metrics()
+	if metrics.EncodedSizeBytes != len(p.EncodedProof)/2 || metrics.EncodedSizeBytes != p.EncodedSizeBytes() {
+		t.Fatalf("expected an encoded size of %d bytes, got %+v", len(p.EncodedProof)/2, metrics)
+	}
+	if metrics.RawSizeBytes != len(p.RawProof)/2 || metrics.RawSizeBytes != raw.Len() {
+		t.Fatalf("expected a raw size of %d bytes, got %+v", raw.Len(), metrics)
+	}
+}
+
+func TestProofWriteJSON(t *testing.T) {
+	proof, _, witnessInput := newTestGroth16Proof(t)
+	p, err := NewZKMGroth16Proof(&proof, witnessInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Proof
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.EncodedProof != p.EncodedProof || decoded.RawProof != p.RawProof {
+		t.Fatal("expected the decoded proof encodings to match")
+	}
+	if !slices.Equal(decoded.PublicInputs, p.PublicInputs) {
+		t.Fatalf("expected public inputs %q, got %q", p.PublicInputs, decoded.PublicInputs)
+	}
+	if !strings.Contains(buf.String(), `"raw_proof":"`+p.RawProof+`"`) {
+		t.Fatal("expected the raw proof to be written verbatim")
+	}
+}
+
+func TestNewZKMProofWrongCurve(t *testing.T) {
+	witnessInput := validTestWitnessInput(t)
+
+	groth16Proof := groth16.NewProof(ecc.BLS12_381)
+	_, err := NewZKMGroth16Proof(&groth16Proof, witnessInput)
+	if err == nil || !strings.Contains(err.Error(), "groth16/bn254.Proof") || !strings.Contains(err.Error(), "groth16/bls12-381.Proof") {
+		t.Fatalf("expected an error naming the expected and actual proof types, got: %v", err)
+	}
+
+	plonkProof := plonk.NewProof(ecc.BLS12_381)
+	_, err = NewZKMPlonkBn254Proof(&plonkProof, witnessInput)
+	if err == nil || !strings.Contains(err.Error(), "plonk/bn254.Proof") || !strings.Contains(err.Error(), "plonk/bls12-381.Proof") {
+		t.Fatalf("expected an error naming the expected and actual proof types, got: %v", err)
+	}
+}
+
+func TestNewZKMGroth16Proofs(t *testing.T) {
+	proof, _, witnessInput := newTestGroth16Proof(t)
+
+	proofs, err := NewZKMGroth16Proofs([]*groth16.Proof{&proof, &proof}, []WitnessInput{witnessInput, witnessInput})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := NewZKMGroth16Proof(&proof, witnessInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, p := range proofs {
+		if p.RawProof != expected.RawProof || p.EncodedProof != expected.EncodedProof {
+			t.Fatalf("proof %d does not match the single-proof encoding", i)
+		}
+	}
+
+	if _, err := NewZKMGroth16Proofs([]*groth16.Proof{&proof}, nil); err == nil {
+		t.Fatal("expected an error for mismatched slice lengths")
+	}
+
+	wrongCurve := groth16.NewProof(ecc.BLS12_381)
+	_, err = NewZKMGroth16Proofs([]*groth16.Proof{&proof, &wrongCurve}, []WitnessInput{witnessInput, witnessInput})
+	if err == nil || !strings.Contains(err.Error(), "proof 1") {
+		t.Fatalf("expected an error naming proof 1, got: %v", err)
+	}
+}
+
+func BenchmarkNewZKMGroth16Proofs(b *testing.B) {
+	proof, _, witnessInput := newTestGroth16Proof(b)
+	proofs := make([]*groth16.Proof, 64)
+	inputs := make([]WitnessInput, 64)
+	for i := range proofs {
+		proofs[i], inputs[i] = &proof, witnessInput
+	}
+
+	b.Run("batch", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := NewZKMGroth16Proofs(proofs, inputs); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("loop", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			result := make([]Proof, len(proofs))
+			for j := range proofs {
+				p, err := NewZKMGroth16Proof(proofs[j], inputs[j])
+				if err != nil {
+					b.Fatal(err)
+				}
+				result[j] = p
+			}
+		}
+	})
+}
@@ -2,12 +2,16 @@ package zkm
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"math/big"
 	"os"
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/backend/plonk"
+	"github.com/consensys/gnark/backend/witness"
 	"github.com/consensys/gnark/frontend"
 	"github.com/ProjectZKM/zkm-recursion-gnark/zkm/koalabear"
 )
@@ -103,3 +107,81 @@ func VerifyGroth16(verifyCmdDataDir string, verifyCmdProof string, verifyCmdVkey
 	err = groth16.Verify(proof, vk, publicWitness)
 	return err
 }
+
+// VerifyGroth16Proof verifies a persisted BN254 Groth16 Proof against the verifying key stored at
+// vkPath. The proof is decoded from p.RawProof and must agree with p.EncodedProof; the public
+// witness is rebuilt from p.PublicInputs.
+func VerifyGroth16Proof(p Proof, vkPath string) error {
+	vkFile, err := os.Open(vkPath)
+	if err != nil {
+		return fmt.Errorf("failed to open verifying key: %w", err)
+	}
+	defer vkFile.Close()
+	vk := groth16.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(vkFile); err != nil {
+		return fmt.Errorf("failed to read verifying key: %w", err)
+	}
+
+	proof, err := DecodeZKMGroth16Proof(p)
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(proof.MarshalSolidity()) != p.EncodedProof {
+		return fmt.Errorf("encoded proof does not match raw proof")
+	}
+
+	publicWitness, err := PublicWitnessFromProof(p, ecc.BN254.ScalarField())
+	if err != nil {
+		return err
+	}
+
+	if err := groth16.Verify(proof, vk, publicWitness); err != nil {
+		return fmt.Errorf("groth16 verification failed: %w", err)
+	}
+	return nil
+}
+
+// PublicWitnessFromProof rebuilds the public witness of p over the scalar field of modulus field
+// from p.PublicInputs: the vkey hash and committed values digest, followed by any extra public
+// inputs, each a canonical decimal field element.
+func PublicWitnessFromProof(p Proof, field *big.Int) (witness.Witness, error) {
+	publicWitness, err := witness.New(field)
+	if err != nil {
+		return nil, err
+	}
+	values := make(chan any, len(p.PublicInputs))
+	for i, input := range p.PublicInputs {
+		if err := validateElement(input, field); err != nil {
+			return nil, fmt.Errorf("invalid public input %d: %w", i, err)
+		}
+		value, _ := new(big.Int).SetString(input, 10)
+		values <- value
+	}
+	close(values)
+	if err := publicWitness.Fill(len(p.PublicInputs), 0, values); err != nil {
+		return nil, fmt.Errorf("failed to build public witness: %w", err)
+	}
+	return publicWitness, nil
+}
+
+// VkeyHash returns the hex-encoded sha256 of the serialized Groth16 verifying key. It matches the
+// Rust prover's groth16 vkey hash over groth16_vk.bin, which selects the on-chain verifier.
+//
+// This fingerprints the gnark verifying key; it is unrelated to WitnessInput.VkeyHash, which
+// commits to the verifying key of the ZKM program being proven.
+func VkeyHash(vk groth16.VerifyingKey) (string, error) {
+	h := sha256.New()
+	if _, err := vk.WriteTo(h); err != nil {
+		return "", fmt.Errorf("failed to serialize verifying key: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// PlonkVkeyHash is VkeyHash for a PLONK verifying key, matching the hash over plonk_vk.bin.
+func PlonkVkeyHash(vk plonk.VerifyingKey) (string, error) {
+	h := sha256.New()
+	if _, err := vk.WriteTo(h); err != nil {
+		return "", fmt.Errorf("failed to serialize verifying key: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,138 @@
+package zkm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/ProjectZKM/zkm-recursion-gnark/zkm/koalabear"
+)
+
+// writeTestVk proves the test circuit and writes its verifying key into a temporary file.
+func writeTestVk(t *testing.T) (Proof, string) {
+	t.Helper()
+	proof, vk, witnessInput := newTestGroth16Proof(t)
+	p, err := NewZKMGroth16Proof(&proof, witnessInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vkPath := filepath.Join(t.TempDir(), groth16VkPath)
+	vkFile, err := os.Create(vkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vkFile.Close()
+	if _, err := vk.WriteTo(vkFile); err != nil {
+		t.Fatal(err)
+	}
+	return p, vkPath
+}
+
+func TestVerifyGroth16Proof(t *testing.T) {
+	p, vkPath := writeTestVk(t)
+	if err := VerifyGroth16Proof(p, vkPath); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyGroth16ProofTampered(t *testing.T) {
+	p, vkPath := writeTestVk(t)
+
+	tampered := []byte(p.EncodedProof)
+	if tampered[0] == '0' {
+		tampered[0] = '1'
+	} else {
+		tampered[0] = '0'
+	}
+	p.EncodedProof = string(tampered)
+	if err := VerifyGroth16Proof(p, vkPath); err == nil {
+		t.Fatal("expected an error for a tampered encoded proof")
+	}
+}
+
+func TestVerifyGroth16ProofWrongPublicInputs(t *testing.T) {
+	p, vkPath := writeTestVk(t)
+
+	p.PublicInputs = []string{p.PublicInputs[0], "16"}
+	if err := VerifyGroth16Proof(p, vkPath); err == nil {
+		t.Fatal("expected an error for a wrong committed values digest")
+	}
+}
+
+func TestVkeyHash(t *testing.T) {
+	_, vkPath := writeTestVk(t)
+	data, err := os.ReadFile(vkPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vk := groth16.NewVerifyingKey(ecc.BN254)
+	if _, err := vk.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := VkeyHash(vk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := sha256.Sum256(data)
+	if hash != hex.EncodeToString(expected[:]) {
+		t.Fatalf("expected the sha256 of %s, %x, got %s", groth16VkPath, expected, hash)
+	}
+}
+
+func TestPublicWitnessFromProof(t *testing.T) {
+	circuit := Circuit{
+		Vars:                  []frontend.Variable{},
+		Felts:                 []koalabear.Variable{},
+		Exts:                  []koalabear.ExtensionVariable{},
+		VkeyHash:              "12345",
+		CommittedValuesDigest: "67890",
+	}
+	full, err := frontend.NewWitness(&circuit, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := full.Public()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actual, err := PublicWitnessFromProof(Proof{PublicInputs: []string{"12345", "67890"}}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedBytes, err := expected.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actualBytes, err := actual.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actualBytes, expectedBytes) {
+		t.Fatal("expected the rebuilt public witness to match the circuit's")
+	}
+
+	// Extra public inputs follow the first two.
+	extended, err := PublicWitnessFromProof(Proof{PublicInputs: []string{"1", "2", "3"}}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vector, ok := extended.Vector().(fr.Vector)
+	if !ok || len(vector) != 3 || vector[2].Uint64() != 3 {
+		t.Fatalf("expected a public witness of [1 2 3], got %v", extended.Vector())
+	}
+
+	modulus := ecc.BN254.ScalarField().String()
+	if _, err := PublicWitnessFromProof(Proof{PublicInputs: []string{"1", modulus}}, ecc.BN254.ScalarField()); err == nil {
+		t.Fatal("expected an error for a non-canonical public input")
+	}
+}
@@ -0,0 +1,106 @@
+package zkm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/ProjectZKM/zkm-recursion-gnark/zkm/koalabear"
+)
+
+// MaxWitnessInputSize is the largest JSON witness, in bytes, that ParseWitnessInput reads.
+var MaxWitnessInputSize int64 = 1 << 30
+
+// ErrWitnessInputTooLarge is returned by ParseWitnessInput for a witness over MaxWitnessInputSize.
+var ErrWitnessInputTooLarge = errors.New("witness input too large")
+
+// WitnessInputError is returned by ParseWitnessInput for malformed JSON.
+type WitnessInputError struct {
+	// Offset is the byte offset in the input at which decoding failed.
+	Offset int64
+	Err    error
+}
+
+func (e *WitnessInputError) Error() string {
+	return fmt.Sprintf("invalid witness input at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *WitnessInputError) Unwrap() error {
+	return e.Err
+}
+
+// ParseWitnessInput decodes a JSON WitnessInput from r without validating it or constructing a
+// circuit. It reads at most MaxWitnessInputSize bytes.
+func ParseWitnessInput(r io.Reader) (WitnessInput, error) {
+	limited := &io.LimitedReader{R: r, N: MaxWitnessInputSize + 1}
+	decoder := json.NewDecoder(limited)
+	var witnessInput WitnessInput
+	err := decoder.Decode(&witnessInput)
+	if limited.N <= 0 {
+		return WitnessInput{}, fmt.Errorf("%w: more than %d bytes", ErrWitnessInputTooLarge, MaxWitnessInputSize)
+	}
+	if err != nil {
+		offset := decoder.InputOffset()
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) {
+			offset = syntaxErr.Offset
+		} else if errors.As(err, &typeErr) {
+			offset = typeErr.Offset
+		}
+		return WitnessInput{}, &WitnessInputError{Offset: offset, Err: err}
+	}
+	return witnessInput, nil
+}
+
+// Validate checks that every value in the witness input is a canonical field element: Vars,
+// VkeyHash and CommittedValuesDigest in the BN254 scalar field, and Felts and every Ext
+// component in the KoalaBear field. Exts must have exactly four components.
+func (w WitnessInput) Validate() error {
+	bn254Modulus := ecc.BN254.ScalarField()
+	if err := validateElement(w.VkeyHash, bn254Modulus); err != nil {
+		return fmt.Errorf("invalid vkey_hash: %w", err)
+	}
+	if err := validateElement(w.CommittedValuesDigest, bn254Modulus); err != nil {
+		return fmt.Errorf("invalid committed_values_digest: %w", err)
+	}
+	for i, v := range w.Vars {
+		if err := validateElement(v, bn254Modulus); err != nil {
+			return fmt.Errorf("invalid vars[%d]: %w", i, err)
+		}
+	}
+	for i, f := range w.Felts {
+		if _, err := koalabear.ParseF(f); err != nil {
+			return fmt.Errorf("invalid felts[%d]: %w", i, err)
+		}
+	}
+	for i, e := range w.Exts {
+		if len(e) != 4 {
+			return fmt.Errorf("invalid exts[%d]: expected 4 components, got %d", i, len(e))
+		}
+		for j, f := range e {
+			if _, err := koalabear.ParseF(f); err != nil {
+				return fmt.Errorf("invalid exts[%d][%d]: %w", i, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateElement checks that s is the decimal representation of an element of [0, modulus).
+func validateElement(s string, modulus *big.Int) error {
+	if s == "" {
+		return fmt.Errorf("empty value")
+	}
+	value, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return fmt.Errorf("%q is not a decimal integer", s)
+	}
+	if value.Sign() < 0 || value.Cmp(modulus) >= 0 {
+		return fmt.Errorf("%s is out of range for modulus %s", s, modulus)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package zkm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func validTestWitnessInput(t testing.TB) WitnessInput {
+	t.Helper()
+	var witnessInput WitnessInput
+	if err := json.Unmarshal([]byte(testWitness), &witnessInput); err != nil {
+		t.Fatal(err)
+	}
+	return witnessInput
+}
+
+func TestWitnessInputValidate(t *testing.T) {
+	if err := validTestWitnessInput(t).Validate(); err != nil {
+		t.Fatalf("expected the test witness to be valid: %v", err)
+	}
+}
+
+func TestWitnessInputValidateBadVkeyHash(t *testing.T) {
+	witnessInput := validTestWitnessInput(t)
+	witnessInput.VkeyHash = "0xnothex"
+
+	err := witnessInput.Validate()
+	if err == nil || !strings.Contains(err.Error(), "vkey_hash") {
+		t.Fatalf("expected a vkey_hash validation error, got: %v", err)
+	}
+}
+
+func TestWitnessInputValidateFeltOutOfRange(t *testing.T) {
+	witnessInput := validTestWitnessInput(t)
+	witnessInput.Felts = []string{"1", "2130706433"}
+
+	err := witnessInput.Validate()
+	if err == nil || !strings.Contains(err.Error(), "felts[1]") {
+		t.Fatalf("expected a felts[1] validation error, got: %v", err)
+	}
+}
+
+func TestWitnessInputValidateShortExt(t *testing.T) {
+	witnessInput := validTestWitnessInput(t)
+	witnessInput.Exts = [][]string{{"1", "2", "3"}}
+
+	if err := witnessInput.Validate(); err == nil {
+		t.Fatal("expected an error for an extension element with three components")
+	}
+}
+
+func TestParseWitnessInput(t *testing.T) {
+	vars := make([]string, 100000)
+	for i := range vars {
+		vars[i] = strconv.Itoa(i)
+	}
+	large, err := json.Marshal(WitnessInput{Vars: vars, VkeyHash: "1", CommittedValuesDigest: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	witnessInput, err := ParseWitnessInput(bytes.NewReader(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(witnessInput.Vars) != len(vars) || witnessInput.VkeyHash != "1" || witnessInput.CommittedValuesDigest != "2" {
+		t.Fatalf("unexpected witness input: %d vars, hashes %q %q", len(witnessInput.Vars), witnessInput.VkeyHash, witnessInput.CommittedValuesDigest)
+	}
+
+	original := MaxWitnessInputSize
+	MaxWitnessInputSize = int64(len(large)) - 1
+	t.Cleanup(func() { MaxWitnessInputSize = original })
+	if _, err := ParseWitnessInput(bytes.NewReader(large)); !errors.Is(err, ErrWitnessInputTooLarge) {
+		t.Fatalf("expected ErrWitnessInputTooLarge, got: %v", err)
+	}
+	MaxWitnessInputSize = int64(len(large))
+	if _, err := ParseWitnessInput(bytes.NewReader(large)); err != nil {
+		t.Fatalf("expected a witness of exactly the limit to parse: %v", err)
+	}
+}
+
+func TestParseWitnessInputSyntaxError(t *testing.T) {
+	_, err := ParseWitnessInput(strings.NewReader(`{"vars": ["1", 2]}`))
+	var witnessErr *WitnessInputError
+	if !errors.As(err, &witnessErr) {
+		t.Fatalf("expected a WitnessInputError, got: %v", err)
+	}
+	if witnessErr.Offset != 16 {
+		t.Fatalf("expected the error at offset 16, got %d", witnessErr.Offset)
+	}
+
+	_, err = ParseWitnessInput(strings.NewReader(`{"vars": ["1",, "2"]}`))
+	if !errors.As(err, &witnessErr) || witnessErr.Offset != 15 {
+		t.Fatalf("expected a WitnessInputError at offset 15, got: %v", err)
+	}
+}
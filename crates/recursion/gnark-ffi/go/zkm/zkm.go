@@ -1,8 +1,10 @@
 package zkm
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 
@@ -13,10 +15,15 @@ import (
 
 var srsFile string = "srs.bin"
 var srsLagrangeFile string = "srs_lagrange.bin"
+var srsDigestFile string = "srs.bin.sha256"
+var srsPowerFile string = "srs.%d.bin"
+var srsPowerDigestFile string = "srs.%d.bin.sha256"
+var srsLagrangeFingerprintFile string = "srs_lagrange.bin.fingerprint"
 var constraintsJsonFile string = "constraints.json"
 var plonkVerifierContractPath string = "PlonkVerifier.sol"
 var groth16VerifierContractPath string = "Groth16Verifier.sol"
 var plonkCircuitPath string = "plonk_circuit.bin"
+var plonkCircuitCachePath string = "plonk_circuit.%s.cache"
 var groth16CircuitPath string = "groth16_circuit.bin"
 var plonkVkPath string = "plonk_vk.bin"
 var groth16VkPath string = "groth16_vk.bin"
@@ -24,6 +31,7 @@ var plonkPkPath string = "plonk_pk.bin"
 var groth16PkPath string = "groth16_pk.bin"
 var plonkWitnessPath string = "plonk_witness.json"
 var groth16WitnessPath string = "groth16_witness.json"
+var buildManifestPath string = "build_manifest.json"
 
 type Circuit struct {
 	VkeyHash              frontend.Variable `gnark:",public"`
@@ -31,6 +39,42 @@ type Circuit struct {
 	Vars                  []frontend.Variable
 	Felts                 []koalabear.Variable
 	Exts                  []koalabear.ExtensionVariable
+
+	// constraintsPath is the constraints file set by WithConstraints.
+	constraintsPath string
+	// groth16 is set by WithGroth16.
+	groth16 bool
+}
+
+// WithConstraints returns a copy of circuit that reads its constraints from path. Without it,
+// Define reads the file named by the CONSTRAINTS_JSON environment variable, which is shared by
+// every build in the process.
+func (circuit Circuit) WithConstraints(path string) Circuit {
+	circuit.constraintsPath = path
+	return circuit
+}
+
+// WithGroth16 returns a copy of circuit that range checks for Groth16, by binary decomposition
+// instead of with a commitment based range checker.
+func (circuit Circuit) WithGroth16() Circuit {
+	circuit.groth16 = true
+	return circuit
+}
+
+// isGroth16 reports whether Define range checks for Groth16.
+func (circuit *Circuit) isGroth16() bool {
+	return circuit.groth16
+}
+
+// constraintsFile returns the constraints file read by Define.
+func (circuit *Circuit) constraintsFile() string {
+	if circuit.constraintsPath != "" {
+		return circuit.constraintsPath
+	}
+	if fileName := os.Getenv("CONSTRAINTS_JSON"); fileName != "" {
+		return fileName
+	}
+	return "constraints.json"
 }
 
 type Constraint struct {
@@ -46,21 +90,51 @@ type WitnessInput struct {
 	CommittedValuesDigest string     `json:"committed_values_digest"`
 }
 
+// Proof is a proof encoded for consumption outside of gnark. PublicInputs always starts with the
+// vkey hash and the committed values digest, followed by any additional public inputs.
 type Proof struct {
-	PublicInputs [2]string `json:"public_inputs"`
-	EncodedProof string    `json:"encoded_proof"`
-	RawProof     string    `json:"raw_proof"`
+	PublicInputs []string `json:"public_inputs"`
+	EncodedProof string   `json:"encoded_proof"`
+	RawProof     string   `json:"raw_proof"`
 }
 
-func (circuit *Circuit) Define(api frontend.API) error {
-	// Get the file name from an environment variable.
-	fileName := os.Getenv("CONSTRAINTS_JSON")
-	if fileName == "" {
-		fileName = "constraints.json"
+// ProofMetrics holds the byte sizes of the encodings in a Proof.
+type ProofMetrics struct {
+	EncodedSizeBytes int
+	RawSizeBytes     int
+}
+
+// EncodedSizeBytes returns the size of the Solidity encoding of the proof, i.e. of the proof
+// calldata for an on-chain verifier.
+func (p Proof) EncodedSizeBytes() int {
+	return hex.DecodedLen(len(p.EncodedProof))
+}
+
+// RawSizeBytes returns the size of the gnark raw encoding of the proof.
+func (p Proof) RawSizeBytes() int {
+	return hex.DecodedLen(len(p.RawProof))
+}
+
+// Metrics returns the sizes of both encodings of the proof.
+func (p Proof) Metrics() ProofMetrics {
+	return ProofMetrics{
+		EncodedSizeBytes: p.EncodedSizeBytes(),
+		RawSizeBytes:     p.RawSizeBytes(),
 	}
+}
+
+// WriteJSON streams the JSON encoding of the proof to w, e.g. to an HTTP response, without
+// first marshalling it into a separate buffer.
+func (p Proof) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	// The fields are hex and decimal strings; there is nothing to escape for HTML.
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(p)
+}
 
+func (circuit *Circuit) Define(api frontend.API) error {
 	// Read the file.
-	data, err := os.ReadFile(fileName)
+	data, err := os.ReadFile(circuit.constraintsFile())
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
@@ -73,15 +147,19 @@ func (circuit *Circuit) Define(api frontend.API) error {
 	}
 
 	hashAPI := poseidon2.NewChip(api)
-	hashKoalaBearAPI := poseidon2.NewKoalaBearChip(api)
+	groth16 := circuit.isGroth16()
 	fieldAPI := koalabear.NewChip(api)
+	if groth16 {
+		fieldAPI = koalabear.NewChipGroth16(api)
+	}
+	hashKoalaBearAPI := poseidon2.NewKoalaBearChip(api, fieldAPI)
 	vars := make(map[string]frontend.Variable)
 	felts := make(map[string]koalabear.Variable)
 	exts := make(map[string]koalabear.ExtensionVariable)
 
 	// Iterate through the witnesses and range check them, if necessary.
 	for i := 0; i < len(circuit.Felts); i++ {
-		if os.Getenv("GROTH16") != "1" {
+		if !groth16 {
 			fieldAPI.RangeChecker.Check(circuit.Felts[i].Value, 31)
 		} else {
 			api.ToBinary(circuit.Felts[i].Value, 31)
@@ -89,7 +167,7 @@ func (circuit *Circuit) Define(api frontend.API) error {
 	}
 	for i := 0; i < len(circuit.Exts); i++ {
 		for j := 0; j < 4; j++ {
-			if os.Getenv("GROTH16") != "1" {
+			if !groth16 {
 				fieldAPI.RangeChecker.Check(circuit.Exts[i].Value[j].Value, 31)
 			} else {
 				api.ToBinary(circuit.Exts[i].Value[j].Value, 31)